@@ -0,0 +1,60 @@
+package main
+
+// subvolumeAdjacency returns, for each subvolume of a grid, the indices of the
+// subvolumes sharing a face with it, in -x, +x, -y, +y, -z, +z order.
+// Subvolumes are matched by their grid cells, so no geometry beyond the grid is
+// needed and halos do not affect them.  Subvolumes that are not grid cells have
+// no neighbors.
+func subvolumeAdjacency(subvols []subvolumeT) [][]int {
+	index := make(map[Point3d]int, len(subvols))
+	for i, subvol := range subvols {
+		if subvol.cell != nil {
+			index[*subvol.cell] = i
+		}
+	}
+	neighbors := make([][]int, len(subvols))
+	for i, subvol := range subvols {
+		neighbors[i] = []int{}
+		if subvol.cell == nil {
+			continue
+		}
+		for axis := range subvol.cell {
+			for _, step := range []int64{-1, 1} {
+				pt := *subvol.cell
+				pt[axis] += step
+				if j, found := index[pt]; found {
+					neighbors[i] = append(neighbors[i], j)
+				}
+			}
+		}
+	}
+	return neighbors
+}
+
+// setComponents numbers the connected components of face-adjacent subvolumes
+// from 1, in order of their first subvolume, and sets each subvolume's
+// Component and NumComponents.
+func (subvolumes *subvolumesT) setComponents(subvols []subvolumeT) {
+	neighbors := subvolumeAdjacency(subvols)
+	numComponents := 0
+	var stack []int
+	for i := range subvols {
+		if subvols[i].Component != 0 {
+			continue
+		}
+		numComponents++
+		subvols[i].Component = numComponents
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, k := range neighbors[j] {
+				if subvols[k].Component == 0 {
+					subvols[k].Component = numComponents
+					stack = append(stack, k)
+				}
+			}
+		}
+	}
+	subvolumes.NumComponents = &numComponents
+}
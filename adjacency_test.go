@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// adjacencySpans occupies two runs of three grid cells along x, a cell beside
+// the first along y, and a cell touching none of them.
+var adjacencySpans = []Span{{0, 0, 0, 40}, {0, 0, 100, 130}, {0, 20, 0, 5}, {40, 40, 40, 40}}
+
+func TestAdjacency(t *testing.T) {
+	want := [][]int{{1, 6}, {0, 2}, {1}, {4}, {3, 5}, {4}, {0}, {}}
+	for _, halo := range []int{0, 32, 600} {
+		opts := testOptions()
+		opts.Adjacency = true
+		opts.Halo = halo
+		subvolumes := partition(t, adjacencySpans, opts)
+		if !reflect.DeepEqual(subvolumes.Adjacency, want) {
+			t.Errorf("halo %d: got adjacency %v, want %v", halo, subvolumes.Adjacency, want)
+		}
+	}
+}
+
+func TestComponents(t *testing.T) {
+	want := []int{1, 1, 1, 2, 2, 2, 1, 3}
+	for _, halo := range []int{0, 32, 600} {
+		for _, summary := range []bool{false, true} {
+			opts := testOptions()
+			opts.Components = true
+			opts.Halo = halo
+			opts.Summary = summary
+			subvolumes := partition(t, adjacencySpans, opts)
+			if subvolumes.NumComponents == nil || *subvolumes.NumComponents != 3 {
+				t.Errorf("halo %d, summary %t: got %v components, want 3", halo, summary, subvolumes.NumComponents)
+			}
+			if summary {
+				continue
+			}
+			var got []int
+			for _, subvol := range subvolumes.Subvolumes {
+				got = append(got, subvol.Component)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("halo %d: got components %v, want %v", halo, got, want)
+			}
+		}
+	}
+}
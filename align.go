@@ -0,0 +1,117 @@
+package main
+
+import "fmt"
+
+// validateAlign checks that a grid aligned to opts.Align voxels can have every
+// subvolume boundary on a multiple of it.
+func validateAlign(opts Options) error {
+	if opts.Align == 0 {
+		return nil
+	}
+	if opts.Align < 0 {
+		return fmt.Errorf("alignment must not be negative, got %d", opts.Align)
+	}
+	if opts.TargetSubvolumes > 0 {
+		return fmt.Errorf("alignment cannot be combined with a target number of subvolumes")
+	}
+	for i, axis := range "xyz" {
+		if size := opts.BatchSize[i] * opts.BlockSize[i]; size%int64(opts.Align) != 0 {
+			return fmt.Errorf("subvolume size along %c of %d voxels is not a multiple of the alignment %d", axis, size, opts.Align)
+		}
+	}
+	return nil
+}
+
+// alignedOrigin returns the largest grid origin no greater than opts.Origin
+// along each axis at which subvolumes start on a multiple of opts.Align voxels.
+// The first subvolumes along each axis then start earlier, still covering
+// every block they did before.
+func (opts Options) alignedOrigin() Point3d {
+	origin := opts.Origin
+	if opts.Align == 0 {
+		return origin
+	}
+	for i := range origin {
+		align := int64(opts.Align)
+		step := align / gcd(align, opts.BlockSize[i])
+		origin[i] = floorDiv(origin[i], step) * step
+	}
+	if origin != opts.Origin {
+		opts.logf("Aligned grid origin %v to %v for %d voxel alignment", opts.Origin, origin, opts.Align)
+	}
+	return origin
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func validateChunkAlign(opts Options) error {
+	if opts.ChunkAlign == 0 {
+		return nil
+	}
+	if opts.ChunkAlign < 0 {
+		return fmt.Errorf("chunk alignment must not be negative, got %d", opts.ChunkAlign)
+	}
+	if opts.NoVoxels || opts.Labeled || opts.Weighted {
+		return fmt.Errorf("chunk alignment is not supported with no voxels, labels or weighted spans")
+	}
+	for i, axis := range "xyz" {
+		if opts.BlockSize[i] > 0 && int64(opts.ChunkAlign)%opts.BlockSize[i] != 0 {
+			return fmt.Errorf("chunk alignment %d is not a multiple of the block size along %c of %d", opts.ChunkAlign, axis, opts.BlockSize[i])
+		}
+	}
+	return nil
+}
+
+// chunkAlignSubvolumes replaces each subvolume crossing a multiple of align
+// voxels along any axis by its pieces between those multiples, so no
+// subvolume straddles a storage chunk of align voxels.  align must be a
+// multiple of the block size along each axis.  spans must be the coalesced
+// spans of all active blocks, sorted by sortSpans.  Empty pieces are dropped,
+// and halos must not have been added.
+func chunkAlignSubvolumes(subvols []subvolumeT, spans []Span, align int, block Point3d) []subvolumeT {
+	var step Point3d
+	for i := range step {
+		step[i] = int64(align) / block[i]
+	}
+	aligned := make([]subvolumeT, 0, len(subvols))
+	for _, subvol := range subvols {
+		box := subvol.ChunkExtents3d
+		var cuts [3][]int64
+		crosses := false
+		for i := range cuts {
+			cuts[i] = append(cuts[i], box.MinChunk[i])
+			for c := (floorDiv(box.MinChunk[i], step[i]) + 1) * step[i]; c <= box.MaxChunk[i]; c += step[i] {
+				cuts[i] = append(cuts[i], c)
+				crosses = true
+			}
+			cuts[i] = append(cuts[i], box.MaxChunk[i]+1)
+		}
+		if !crosses {
+			aligned = append(aligned, subvol)
+			continue
+		}
+		for z := 1; z < len(cuts[2]); z++ {
+			for y := 1; y < len(cuts[1]); y++ {
+				for x := 1; x < len(cuts[0]); x++ {
+					piece := ChunkExtents3d{
+						MinChunk: Point3d{cuts[0][x-1], cuts[1][y-1], cuts[2][z-1]},
+						MaxChunk: Point3d{cuts[0][x] - 1, cuts[1][y] - 1, cuts[2][z] - 1},
+					}
+					var active int64
+					for _, span := range boxSpans(spans, piece) {
+						active += span[3] - span[2] + 1
+					}
+					if active > 0 {
+						aligned = append(aligned, newSubvolume(piece, active, block))
+					}
+				}
+			}
+		}
+	}
+	return aligned
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlign(t *testing.T) {
+	// With the grid starting at block 5, 512 voxel alignment moves it back to
+	// block 0, so block 2 moves from the cell at -11 to the cell at 0.
+	spans := []Span{{0, 0, 2, 2}, {0, 0, 30, 30}}
+	tests := []struct {
+		align int
+		keys  []string
+	}{
+		{0, []string{"-11_0_0", "21_0_0"}},
+		{512, []string{"0_0_0", "16_0_0"}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.Origin = Point3d{5, 0, 0}
+		opts.Align = test.align
+		opts.AssertCover = true
+		subvolumes := partition(t, spans, opts)
+		if len(subvolumes.Subvolumes) != len(test.keys) {
+			t.Fatalf("align %d: got %d subvolumes, want %d", test.align, len(subvolumes.Subvolumes), len(test.keys))
+		}
+		for i, subvol := range subvolumes.Subvolumes {
+			if subvol.Key != test.keys[i] {
+				t.Errorf("align %d: subvolume %d has key %s, want %s", test.align, i, subvol.Key, test.keys[i])
+			}
+			if test.align > 0 && subvol.MinPoint[0]%int64(test.align) != 0 {
+				t.Errorf("align %d: subvolume %s starts at voxel %d", test.align, subvol.Key, subvol.MinPoint[0])
+			}
+		}
+	}
+}
+
+func TestChunkAlign(t *testing.T) {
+	spans := []Span{{0, 0, 0, 40}}
+	tests := []struct {
+		origin     Point3d
+		chunkAlign int
+		keys       []string
+		active     []int64
+	}{
+		{Point3d{}, 0, []string{"0_0_0", "16_0_0", "32_0_0"}, []int64{16, 16, 9}},
+		{Point3d{}, 512, []string{"0_0_0", "16_0_0", "32_0_0"}, []int64{16, 16, 9}},
+		{Point3d{}, 256, []string{"0_0_0", "8_0_0", "16_0_0", "24_0_0", "32_0_0", "40_0_0"}, []int64{8, 8, 8, 8, 8, 1}},
+		// Cells starting at block 5 are split at multiples of 16 blocks, and
+		// the empty pieces dropped.
+		{Point3d{5, 0, 0}, 512, []string{"0_0_0", "5_0_0", "16_0_0", "21_0_0", "32_0_0", "37_0_0"}, []int64{5, 11, 5, 11, 5, 4}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.Origin = test.origin
+		opts.ChunkAlign = test.chunkAlign
+		opts.AssertCover = true
+		subvolumes := partition(t, spans, opts)
+		var keys []string
+		var active []int64
+		for _, subvol := range subvolumes.Subvolumes {
+			keys = append(keys, subvol.Key)
+			active = append(active, subvol.ActiveBlocks)
+			for i := range subvol.MinChunk {
+				if subvol.MinPoint[i] != subvol.MinChunk[i]*32 || subvol.MaxPoint[i] != subvol.MaxChunk[i]*32+31 {
+					t.Errorf("chunk align %d: subvolume %s has voxel extents %v for blocks %v",
+						test.chunkAlign, subvol.Key, subvol.Extents3d, subvol.ChunkExtents3d)
+				}
+				if n := int64(test.chunkAlign); n > 0 && floorDiv(subvol.MinPoint[i], n) != floorDiv(subvol.MaxPoint[i], n) {
+					t.Errorf("chunk align %d: subvolume %s straddles a chunk: %v", test.chunkAlign, subvol.Key, subvol.Extents3d)
+				}
+			}
+		}
+		if !reflect.DeepEqual(keys, test.keys) || !reflect.DeepEqual(active, test.active) {
+			t.Errorf("chunk align %d, origin %v: got subvolumes %v with %v active blocks, want %v with %v",
+				test.chunkAlign, test.origin, keys, active, test.keys, test.active)
+		}
+	}
+
+	for _, chunkAlign := range []int{-512, 100} {
+		opts := testOptions()
+		opts.ChunkAlign = chunkAlign
+		if _, err := Partition(t.Context(), spans, opts); err == nil {
+			t.Errorf("chunk align %d: got no error", chunkAlign)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "sort"
+
+// boundaryBlocks counts, for each grid cell, the active blocks that share a
+// face with an active block of another cell.  spans must be coalesced and
+// sorted by sortSpans, as finish leaves them when retaining spans.
+//
+// Blocks of a row can only neighbor another cell along x where the row
+// crosses a cell boundary.  Along y and z, either every block of a row lies
+// in a different cell than the neighboring row or none does, so the
+// boundary blocks are the overlaps with the spans of neighboring rows that
+// cross a cell boundary.
+func (acc *accumulator) boundaryBlocks(spans []Span) map[Point3d]int64 {
+	rows := make(map[[2]int64][]Span)
+	for _, span := range spans {
+		row := [2]int64{span[0], span[1]}
+		rows[row] = append(rows[row], span)
+	}
+
+	batch, origin := acc.opts.BatchSize, acc.opts.Origin
+	cellOf := func(coord int64, axis int) int64 {
+		return floorDiv(coord-origin[axis], batch[axis])
+	}
+	counts := make(map[Point3d]int64)
+	var marked []Span
+	for _, span := range spans {
+		z, y, x0, x1 := span[0], span[1], span[2], span[3]
+		marked = marked[:0]
+
+		// Blocks on either side of each cell boundary along x.
+		for gx := cellOf(x0, 0) + 1; gx <= cellOf(x1, 0); gx++ {
+			x := origin[0] + gx*batch[0]
+			marked = append(marked, Span{z, y, x - 1, x})
+		}
+
+		// Overlaps with neighboring rows in other cells along y or z.
+		for _, next := range [][2]int64{{z, y - 1}, {z, y + 1}, {z - 1, y}, {z + 1, y}} {
+			if cellOf(next[0], 2) == cellOf(z, 2) && cellOf(next[1], 1) == cellOf(y, 1) {
+				continue
+			}
+			row := rows[next]
+			i := sort.Search(len(row), func(i int) bool { return row[i][3] >= x0 })
+			for ; i < len(row) && row[i][2] <= x1; i++ {
+				marked = append(marked, Span{z, y, max(x0, row[i][2]), min(x1, row[i][3])})
+			}
+		}
+
+		// Count each marked block once, in the cell along x it falls in.
+		gy, gz := cellOf(y, 1), cellOf(z, 2)
+		for _, piece := range coalesceSpans(marked) {
+			for gx := cellOf(piece[2], 0); gx <= cellOf(piece[3], 0); gx++ {
+				lo := max(piece[2], origin[0]+gx*batch[0])
+				hi := min(piece[3], origin[0]+(gx+1)*batch[0]-1)
+				counts[Point3d{gx, gy, gz}] += hi - lo + 1
+			}
+		}
+	}
+	return counts
+}
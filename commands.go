@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of partition.  Its flags follow its name on the
+// command line and are followed by any input files.
+type command struct {
+	// Usage line and description printed by "partition help <command>".
+	help string
+
+	// run parses the command's flags from args and executes it.
+	run func(ctx context.Context, args []string)
+}
+
+// commands are the recognized commands.  Without one, partition runs the
+// partition command.  Set in init since help refers back to commands.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"partition": {partitionHelp, runPartition},
+		"bbox":      {bboxHelp, runBBox},
+		"expand":    {expandHelp, runExpandCommand},
+		"help":      {helpHelp, runHelp},
+		"post":      {postHelp, runPost},
+		"validate":  {validateHelp, runValidate},
+		"version":   {versionHelp, runVersion},
+	}
+}
+
+const partitionHelp = `
+Usage: partition [options] partition [options] [input files]
+
+Partition spans into subvolumes.  This is the default command, and takes the
+options listed by "partition -help" before or after its name.
+`
+
+const bboxHelp = `
+Usage: partition [options] bbox [input files]
+
+Write the number of active blocks of the input spans and their bounding box
+in voxels and blocks as JSON, without partitioning them.
+`
+
+const expandHelp = `
+Usage: partition [options] expand [input file]
+
+Read subvolumes output by partition and write the spans of blocks they cover.
+Half-open extents and subvolumes with only voxel extents are read as written.
+`
+
+const helpHelp = `
+Usage: partition help [command]
+
+Show the help message of partition, or of the given command.
+`
+
+const postHelp = `
+Usage: partition [options] post -server <url> -uuid <uuid> -name <roi> [-dryrun] [input files]
+
+Post the active blocks of the input as spans to a DVID ROI instance.  With
+-dryrun, the request is printed instead of sent.
+
+The spans are sent with POST, the method DVID's ROI endpoint accepts for adding
+spans to an ROI; it does not accept PUT.  A request the server does not
+answer within 5 minutes, or interrupted with Ctrl-C, fails.
+
+Command options:
+
+`
+
+const validateHelp = `
+Usage: partition [options] validate [-allow-negative] [-max-errors N] [input files]
+
+Check the input spans without partitioning them and report the first errors.
+Spans are read as partition reads them, so -run-axis, -exclusive-x and the
+other options interpreting spans apply.  Spans must have X0 <= X1 unless
+-swap-reversed is given and, without -allow-negative, non-negative coordinates.
+
+Command options:
+
+`
+
+const versionHelp = `
+Usage: partition version
+
+Show version, git commit and build date.
+`
+
+// commandFlags returns an empty flag set for the named command that prints
+// the command's help on -h or bad flags.
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), commands[name].help)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// inputPaths returns the input files of a command, including -input.
+func inputPaths(files []string) []string {
+	if *inputPath != "" {
+		return append([]string{*inputPath}, files...)
+	}
+	return files
+}
+
+// configuredOptions returns the partitioning options of the flags after
+// applying any -config file, exiting if it is invalid.
+func configuredOptions() Options {
+	if *configPath != "" {
+		if err := applyConfig(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	return partitionOptions()
+}
+
+func runPartition(ctx context.Context, args []string) {
+	// The global flags may follow the command name too
+	flag.CommandLine.Parse(args)
+	if *showHelp {
+		usage()
+		os.Exit(0)
+	}
+	setJSONOptions()
+	opts := configuredOptions()
+	if *overlapReport {
+		if *estimate || *splitDir != "" {
+			fmt.Fprintf(os.Stderr, "Error: -overlap-report cannot be combined with -estimate or -split-dir\n")
+			os.Exit(1)
+		}
+		process(inputPaths(flag.Args()), func(sources []Source, w io.Writer) error {
+			overlap, err := Overlap(ctx, sources, opts)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, overlap)
+		})
+		return
+	}
+	if *estimate {
+		if *outputPath != "" || *splitDir != "" {
+			fmt.Fprintf(os.Stderr, "Error: -estimate writes to standard error and cannot be combined with -output or -split-dir\n")
+			os.Exit(1)
+		}
+		process(inputPaths(flag.Args()), func(sources []Source, w io.Writer) error {
+			estimate, err := Estimate(ctx, sources, opts)
+			if err != nil {
+				return err
+			}
+			return writeEstimate(os.Stderr, estimate)
+		})
+		return
+	}
+	// The offset of an npy array is written to <output>.json alongside it.
+	var npyInfo bytes.Buffer
+	if opts.outputFormat() == "npy" && *outputPath != "" {
+		opts.NPYInfo = &npyInfo
+	}
+	process(inputPaths(flag.Args()), func(sources []Source, w io.Writer) error {
+		return RunSources(ctx, sources, w, opts)
+	})
+	if opts.NPYInfo != nil {
+		path := strings.TrimSuffix(*outputPath, ".gz") + ".json"
+		f, err := createOutput(path)
+		if err == nil {
+			if _, err = f.Write(npyInfo.Bytes()); err != nil {
+				f.Abort()
+			} else {
+				err = f.Commit()
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing npy info file %q: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// writeEstimate writes the estimate for -estimate in a readable form.
+func writeEstimate(w io.Writer, estimate estimateT) error {
+	batch := estimate.BatchSize
+	box := "none"
+	if extents := estimate.ActiveChunkExtents; extents != nil {
+		box = fmt.Sprintf("%v to %v", [3]int64(extents.MinChunk), [3]int64(extents.MaxChunk))
+	}
+	_, err := fmt.Fprintf(w, "Active block bounding box (x, y, z): %s\nActive blocks: %d\nSubvolumes of %dx%dx%d blocks: %d\n",
+		box, estimate.NumActiveBlocks, batch[0], batch[1], batch[2], estimate.NumSubvolumes)
+	if err != nil {
+		return fmt.Errorf("error writing estimate: %s", err.Error())
+	}
+	return nil
+}
+
+func runBBox(ctx context.Context, args []string) {
+	flags := commandFlags("bbox")
+	flags.Parse(args)
+	paths := inputPaths(flags.Args())
+	opts := configuredOptions()
+	process(paths, func(sources []Source, w io.Writer) error {
+		bounds, err := BoundingBox(ctx, sources, opts)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, bounds)
+	})
+}
+
+func runExpandCommand(ctx context.Context, args []string) {
+	flags := commandFlags("expand")
+	flags.Parse(args)
+	paths := inputPaths(flags.Args())
+	if len(paths) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: expand reads a single input file, got %d\n", len(paths))
+		os.Exit(1)
+	}
+	process(paths, func(sources []Source, w io.Writer) error {
+		return RunExpand(sources[0].Reader, w)
+	})
+}
+
+func runHelp(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		usage()
+		os.Exit(0)
+	}
+	name := strings.ToLower(args[0])
+	if _, found := commands[name]; !found {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+	if name == "partition" {
+		// The partition command takes the global options
+		fmt.Fprint(os.Stderr, partitionHelp)
+		os.Exit(0)
+	}
+	flags := commandFlags(name)
+	switch name {
+	case "post":
+		new(postCommand).defineFlags(flags)
+	case "validate":
+		new(validateCommand).defineFlags(flags)
+	}
+	flags.Usage()
+	os.Exit(0)
+}
+
+func runPost(ctx context.Context, args []string) {
+	var post postCommand
+	paths := inputPaths(post.parseFlags(args))
+	opts := configuredOptions()
+	opts.OutputFormat = "dvidroi"
+	process(paths, func(sources []Source, w io.Writer) error {
+		var roi bytes.Buffer
+		if err := RunSources(ctx, sources, &roi, opts); err != nil {
+			return err
+		}
+		return post.send(ctx, w, roi.Bytes())
+	})
+}
+
+func runValidate(ctx context.Context, args []string) {
+	var validate validateCommand
+	paths := inputPaths(validate.parseFlags(args))
+	opts := configuredOptions()
+	process(paths, func(sources []Source, w io.Writer) error {
+		return validate.run(ctx, sources, w, opts)
+	})
+}
+
+func runVersion(ctx context.Context, args []string) {
+	commandFlags("version").Parse(args)
+	if err := writeVersion(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
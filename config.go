@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// configField maps an Options field of a config file to the flags it sets.
+// An array value sets one flag per element, unless join is true, in which case
+// its elements are joined by commas into a single flag.  The field is ignored
+// if any of its flags or of overridden was set on the command line, so flags
+// win over the config file.
+type configField struct {
+	flags      []string
+	join       bool
+	overridden []string
+}
+
+// configFields are the fields of Options a config file can set, by name.
+var configFields = map[string]configField{
+	"BatchSize":        {flags: []string{"batchsize-x", "batchsize-y", "batchsize-z"}, overridden: []string{"batchsize", "subvolume-voxels", "target-subvolumes"}},
+	"BlockSize":        {flags: []string{"blocksize-x", "blocksize-y", "blocksize-z"}, overridden: []string{"blocksize", "no-voxels"}},
+	"NoVoxels":         {flags: []string{"no-voxels"}, overridden: []string{"blocksize", "blocksize-x", "blocksize-y", "blocksize-z", "subvolume-voxels"}},
+	"Origin":           {flags: []string{"origin-x", "origin-y", "origin-z"}},
+	"Resolution":       {flags: []string{"resolution"}, join: true},
+	"Align":            {flags: []string{"align"}},
+	"ChunkAlign":       {flags: []string{"chunk-align"}},
+	"InputFormat":      {flags: []string{"format"}},
+	"Radius":           {flags: []string{"radius"}},
+	"JSONPointer":      {flags: []string{"json-pointer"}},
+	"EmbeddedEncoding": {flags: []string{"embedded-encoding"}},
+	"OutputFormat":     {flags: []string{"output-format"}},
+	"Scale":            {flags: []string{"scale"}},
+	"Summary":          {flags: []string{"summary"}},
+	"CountOnly":        {flags: []string{"count-only"}},
+	"FailOnEmpty":      {flags: []string{"fail-on-empty"}},
+	"MinActiveBlocks":  {flags: []string{"min-active-blocks"}},
+	"Halo":             {flags: []string{"halo"}},
+	"TargetSubvolumes": {flags: []string{"target-subvolumes"}, overridden: []string{"batchsize", "batchsize-x", "batchsize-y", "batchsize-z", "subvolume-voxels"}},
+	"Mode":             {flags: []string{"mode"}},
+	"LeafMax":          {flags: []string{"leaf-max"}},
+	"Partitions":       {flags: []string{"partitions"}},
+	"MergeMax":         {flags: []string{"merge-max"}, overridden: []string{"merge"}},
+	"MaxActiveBlocks":  {flags: []string{"max-active-blocks"}},
+	"Adjacency":        {flags: []string{"adjacency"}},
+	"Components":       {flags: []string{"components"}},
+	"Order":            {flags: []string{"order"}},
+	"Units":            {flags: []string{"units"}},
+	"HalfOpen":         {flags: []string{"half-open"}},
+	"Boundary":         {flags: []string{"boundary"}},
+	"AssertCover":      {flags: []string{"assert-cover"}},
+	"SubvolumeSpans":   {flags: []string{"coalesce-output"}},
+	"Stream":           {flags: []string{"stream"}},
+	"SplitDir":         {flags: []string{"split-dir"}},
+	"GridSize":         {flags: []string{"grid-size"}},
+	"Dedup":            {flags: []string{"dedup"}},
+	"VoxelCoords":      {flags: []string{"voxel-coords"}},
+	"ExclusiveX":       {flags: []string{"exclusive-x"}},
+	"RunAxis":          {flags: []string{"run-axis"}},
+	"Labeled":          {flags: []string{"labeled"}},
+	"Weighted":         {flags: []string{"weighted"}},
+	"SkipBad":          {flags: []string{"skip-bad"}},
+	"Parallel":         {flags: []string{"parallel"}},
+}
+
+// applyConfig sets the flags of the Options fields in the JSON config file at
+// path that were not set on the command line.  A positive MergeMax implies
+// -merge, as the config has no separate field for it.
+func applyConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %s", err.Error())
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("error decoding config file %q: %s", path, err.Error())
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// Apply fields in name order so errors do not depend on map order.
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, found := configFields[name]
+		if !found {
+			return fmt.Errorf("config file %q: unknown option %q", path, name)
+		}
+		overridden := false
+		for _, f := range append(field.flags, field.overridden...) {
+			overridden = overridden || set[f]
+		}
+		if overridden {
+			continue
+		}
+		values, err := configValues(config[name], len(field.flags), field.join)
+		if err != nil {
+			return fmt.Errorf("config file %q: %s %s", path, name, err.Error())
+		}
+		for i, f := range field.flags {
+			if err := flag.Set(f, values[i]); err != nil {
+				return fmt.Errorf("config file %q: invalid value %q for %s: %s", path, values[i], name, err.Error())
+			}
+		}
+		if name == "MergeMax" && values[0] != "0" {
+			flag.Set("merge", "true")
+		}
+	}
+	return nil
+}
+
+// configValues returns the flag values of a config value for n flags.  Values
+// for several flags, or for one joined flag, must be arrays.
+func configValues(raw json.RawMessage, n int, join bool) ([]string, error) {
+	if n == 1 && !join {
+		value, err := configValue(raw)
+		return []string{value}, err
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil || (!join && len(elements) != n) {
+		return nil, fmt.Errorf("must be an array of %d values, got %s", n, raw)
+	}
+	values := make([]string, len(elements))
+	for i, element := range elements {
+		value, err := configValue(element)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	if join {
+		return []string{strings.Join(values, ",")}, nil
+	}
+	return values, nil
+}
+
+// configValue returns a JSON string, number or boolean as a flag value.
+func configValue(raw json.RawMessage) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("has invalid value: %s", err.Error())
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return strings.TrimSpace(string(raw)), nil
+	}
+	return "", fmt.Errorf("must be a string, number or boolean, got %s", raw)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file of the JSON config for the test, returning
+// its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigCommands(t *testing.T) {
+	// Every command partitioning spans applies the config.
+	exclusive := writeConfig(t, `{"ExclusiveX": true}`)
+	tests := []struct {
+		name, input string
+		args        []string
+		status      int
+		output      string
+	}{
+		{"partition", `[[0,0,0,3]]`, []string{"-config", exclusive, "-pretty=false", "-units", "blocks"}, 0, `"MaxChunk":[2,0,0]`},
+		{"bbox", `[[0,0,0,3]]`, []string{"-config", exclusive, "-pretty=false", "bbox"}, 0, `"MaxChunk":[2,0,0]`},
+		{"post", `[[0,0,0,3]]`, []string{"-config", exclusive, "post", "-server", "http://localhost", "-uuid", "u", "-name", "roi", "-dryrun"}, 0, "[0,0,0,2]"},
+		{"validate", `[[0,-1,0,1]]`, []string{"-config", writeConfig(t, `{"RunAxis": "y"}`), "validate"}, 1, "span 0 [0 -1 0 1] has negative X"},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runCLI(t, test.input, test.args...)
+		if status != test.status {
+			t.Errorf("%s: exit status %d, want %d: %s", test.name, status, test.status, stderr)
+		}
+		if !strings.Contains(stdout, test.output) {
+			t.Errorf("%s: got output %q, want %q", test.name, stdout, test.output)
+		}
+	}
+}
+
+func TestConfigOverridden(t *testing.T) {
+	// Flags conflicting with a config field override it rather than fail.
+	tests := []struct {
+		config string
+		args   []string
+		output string
+	}{
+		{`{"BlockSize": [16, 16, 16]}`, []string{"-no-voxels"}, `"Params":{"BatchSize":[16,16,16],"Origin":[0,0,0],"Mode":"grid"}`},
+		{`{"NoVoxels": true}`, []string{"-blocksize", "8"}, `"BlockSize":[8,8,8]`},
+		{`{"NoVoxels": true}`, []string{"-blocksize-z", "8"}, `"BlockSize":[32,32,8]`},
+		{`{"NoVoxels": true}`, []string{"-subvolume-voxels", "256"}, `"BatchSize":[8,8,8],"BlockSize":[32,32,32]`},
+		{`{"BatchSize": [4, 4, 4]}`, []string{"-subvolume-voxels", "256"}, `"BatchSize":[8,8,8]`},
+	}
+	for _, test := range tests {
+		args := append([]string{"-config", writeConfig(t, test.config), "-pretty=false", "-summary"}, test.args...)
+		stdout, stderr, status := runCLI(t, `[[0,0,0,3]]`, args...)
+		if status != 0 {
+			t.Errorf("config %s, flags %v: exit status %d: %s", test.config, test.args, status, stderr)
+		}
+		if !strings.Contains(stdout, test.output) {
+			t.Errorf("config %s, flags %v: got output %s, want %s", test.config, test.args, stdout, test.output)
+		}
+	}
+}
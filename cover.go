@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// checkCover returns an error naming the first active block that is not in
+// exactly one of subvols, or a subvolume whose ActiveBlocks is not the number
+// of active blocks within it.  spans must be the coalesced spans of all active
+// blocks, sorted by sortSpans, and halos must not have been added.
+func checkCover(subvols []subvolumeT, spans []Span) error {
+	// The active blocks of each subvolume, which do not overlap each other.
+	type piece struct {
+		span   Span
+		subvol int
+	}
+	var pieces []piece
+	for i, subvol := range subvols {
+		var active int64
+		for _, span := range boxSpans(spans, subvol.ChunkExtents3d) {
+			pieces = append(pieces, piece{span, i})
+			active += span[3] - span[2] + 1
+		}
+		if active != subvol.ActiveBlocks {
+			return fmt.Errorf("subvolume %s has %d active blocks but contains %d", chunkKey(subvol.MinChunk), subvol.ActiveBlocks, active)
+		}
+	}
+	sort.Slice(pieces, func(i, j int) bool {
+		a, b := pieces[i].span, pieces[j].span
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+
+	for i := 1; i < len(pieces); i++ {
+		prev, span := pieces[i-1].span, pieces[i].span
+		if prev[0] == span[0] && prev[1] == span[1] && span[2] <= prev[3] {
+			return fmt.Errorf("block (%d, %d, %d) is in both subvolume %s and %s", span[2], span[1], span[0],
+				chunkKey(subvols[pieces[i-1].subvol].MinChunk), chunkKey(subvols[pieces[i].subvol].MinChunk))
+		}
+	}
+
+	// Each span must be tiled by the pieces within it, in order.
+	j := 0
+	for _, span := range spans {
+		x := span[2]
+		for ; j < len(pieces) && pieces[j].span[0] == span[0] && pieces[j].span[1] == span[1] && pieces[j].span[2] <= span[3]; j++ {
+			if pieces[j].span[2] != x {
+				break
+			}
+			x = pieces[j].span[3] + 1
+		}
+		if x <= span[3] {
+			return fmt.Errorf("block (%d, %d, %d) is in no subvolume", x, span[1], span[0])
+		}
+	}
+	return nil
+}
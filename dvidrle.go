@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// dvidRLEHeader starts DVID's binary sparse volume RLE format.  It is followed
+// by NumSpans runs of little-endian int32 x, y, z and run length along x.
+type dvidRLEHeader struct {
+	Descriptor uint8 // 0 for a binary sparse volume
+	NumDims    uint8 // always 3
+	RunDim     uint8 // 0 for runs along x
+	Reserved   uint8
+	NumVoxels  uint32 // 0 if not known
+	NumSpans   uint32
+}
+
+// decodeDVIDRLESpans reads spans in DVID's binary sparse volume RLE format,
+// as served by its sparsevol endpoint, passing each to fn.  DVID's runs are
+// usually in voxel coordinates, so -voxel-coords is needed to partition them.
+// Runs with a length less than one are passed to bad.
+func decodeDVIDRLESpans(r io.Reader, fn func(Span) error, bad func(error) error) error {
+	var header dvidRLEHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("error reading DVID RLE header: %s", err.Error())
+	}
+	if header.Descriptor != 0 || header.NumDims != 3 || header.RunDim != 0 {
+		return fmt.Errorf("unsupported DVID RLE header: descriptor %d with %d dimensions and runs along dimension %d",
+			header.Descriptor, header.NumDims, header.RunDim)
+	}
+	var run [4]int32
+	for i := uint32(0); i < header.NumSpans; i++ {
+		if err := binary.Read(r, binary.LittleEndian, &run); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("error reading DVID RLE run %d of %d: %s", i, header.NumSpans, err.Error())
+		}
+		x, y, z, length := int64(run[0]), int64(run[1]), int64(run[2]), int64(run[3])
+		if length < 1 {
+			if err := bad(fmt.Errorf("DVID RLE run %d at (%d, %d, %d) has length %d", i, x, y, z, length)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(Span{z, y, x, x + length - 1}); err != nil {
+			return err
+		}
+	}
+	var extra [1]byte
+	if _, err := io.ReadFull(r, extra[:]); err == nil {
+		return fmt.Errorf("unexpected data after %d DVID RLE runs", header.NumSpans)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Encodings of spans embedded as a string in a JSON envelope: "base64" (the
+// default) or "none" for the string itself.  Either may be gzipped.
+const (
+	base64Embedding = "base64"
+	noEmbedding     = "none"
+)
+
+func (opts Options) embeddedEncoding() string {
+	if opts.EmbeddedEncoding == "" {
+		return base64Embedding
+	}
+	return opts.EmbeddedEncoding
+}
+
+func validateEmbedded(opts Options) error {
+	if opts.JSONPointer != "" && !strings.HasPrefix(opts.JSONPointer, "/") {
+		return fmt.Errorf("JSON pointer must start with /, got %q", opts.JSONPointer)
+	}
+	switch opts.embeddedEncoding() {
+	case base64Embedding, noEmbedding:
+		return nil
+	}
+	return fmt.Errorf("unknown embedded encoding %q", opts.EmbeddedEncoding)
+}
+
+// embeddedSpans returns a reader of the spans embedded in the JSON envelope in
+// r at opts.JSONPointer, or r itself if no pointer is set.  A string value is
+// decoded with opts.EmbeddedEncoding and decompressed if gzipped, and any other
+// value is read as JSON spans.
+func (opts Options) embeddedSpans(r io.Reader) (io.Reader, error) {
+	if opts.JSONPointer == "" {
+		return r, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading input: %s", err.Error())
+	}
+	value, err := resolvePointer(data, opts.JSONPointer)
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return bytes.NewReader(value), nil
+	}
+	embedded := []byte(s)
+	if opts.embeddedEncoding() == base64Embedding {
+		if embedded, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("error decoding base64 spans at %s: %s", opts.JSONPointer, err.Error())
+		}
+	}
+	return decompress(bytes.NewReader(embedded))
+}
+
+// resolvePointer returns the value within the JSON document data at the RFC
+// 6901 JSON pointer.
+func resolvePointer(data []byte, pointer string) (json.RawMessage, error) {
+	value := json.RawMessage(data)
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err == nil && object != nil {
+			next, found := object[token]
+			if !found {
+				return nil, fmt.Errorf("JSON pointer %s: no member %q", pointer, token)
+			}
+			value = next
+			continue
+		}
+		var array []json.RawMessage
+		if err := json.Unmarshal(value, &array); err != nil || array == nil {
+			return nil, fmt.Errorf("JSON pointer %s: %q is not within an object or array", pointer, token)
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(array) {
+			return nil, fmt.Errorf("JSON pointer %s: no element %q", pointer, token)
+		}
+		value = array[i]
+	}
+	return value, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "sort"
+
+// exclusion holds coalesced spans of excluded blocks keyed by (z, y) row.
+type exclusion map[[2]int64][]Span
+
+// newExclusion indexes spans for subtraction, returning nil if there are none.
+func newExclusion(spans []Span) exclusion {
+	if len(spans) == 0 {
+		return nil
+	}
+	rows := make(exclusion)
+	for _, span := range coalesceSpans(append([]Span(nil), spans...)) {
+		row := [2]int64{span[0], span[1]}
+		rows[row] = append(rows[row], span)
+	}
+	return rows
+}
+
+// subtract passes the parts of span not covered by ex to fn, in x order.
+func (ex exclusion) subtract(span Span, fn func(Span) error) error {
+	if ex == nil || span[2] > span[3] {
+		return fn(span)
+	}
+	row := ex[[2]int64{span[0], span[1]}]
+	i := sort.Search(len(row), func(i int) bool { return row[i][3] >= span[2] })
+	for ; i < len(row) && row[i][2] <= span[3]; i++ {
+		if row[i][2] > span[2] {
+			piece := span
+			piece[3] = row[i][2] - 1
+			if err := fn(piece); err != nil {
+				return err
+			}
+		}
+		span[2] = row[i][3] + 1
+	}
+	if span[2] > span[3] {
+		return nil
+	}
+	return fn(span)
+}
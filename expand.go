@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Expand returns the spans of all blocks within the chunk extents of the given
+// subvolumes, coalesced so each (z, y) row has maximal non-overlapping runs.
+func Expand(subvolumes subvolumesT) []Span {
+	var spans []Span
+	for _, subvol := range subvolumes.Subvolumes {
+		minChunk, maxChunk := subvol.MinChunk, subvol.MaxChunk
+		for z := minChunk[2]; z <= maxChunk[2]; z++ {
+			for y := minChunk[1]; y <= maxChunk[1]; y++ {
+				spans = append(spans, Span{z, y, minChunk[0], maxChunk[0]})
+			}
+		}
+	}
+	return coalesceSpans(spans)
+}
+
+// RunExpand decodes subvolumes in JSON from r and writes the spans of blocks
+// they cover to w as a JSON array.  Half-open extents and subvolumes with
+// only voxel extents are read as written by -half-open and -units voxels.
+func RunExpand(r io.Reader, w io.Writer) error {
+	r, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading subvolumes JSON: %s", err.Error())
+	}
+	var subvolumes subvolumesT
+	if err := json.Unmarshal(data, &subvolumes); err != nil {
+		return fmt.Errorf("error parsing subvolumes JSON: %s", err.Error())
+	}
+	if err := subvolumes.decodedChunks(data); err != nil {
+		return err
+	}
+	return encodeSpans(w, Expand(subvolumes))
+}
+
+// decodedChunks makes the extents of subvolumes decoded from data inclusive if
+// Params.HalfOpen is set, and derives the chunk extents of subvolumes without
+// them from their voxel extents and Params.BlockSize.
+func (subvolumes *subvolumesT) decodedChunks(data []byte) error {
+	var chunks struct {
+		Subvolumes []struct {
+			MinChunk *Point3d
+		}
+	}
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		return fmt.Errorf("error parsing subvolumes JSON: %s", err.Error())
+	}
+	for i := range subvolumes.Subvolumes {
+		subvol := &subvolumes.Subvolumes[i]
+		if subvolumes.Params.HalfOpen {
+			for axis := range subvol.MaxPoint {
+				subvol.MaxPoint[axis]--
+				subvol.MaxChunk[axis]--
+			}
+		}
+		if chunks.Subvolumes[i].MinChunk != nil {
+			continue
+		}
+		block := subvolumes.Params.BlockSize
+		if block == nil {
+			return fmt.Errorf("subvolume %d has no block extents and there is no block size to derive them from", i)
+		}
+		for axis := range block {
+			subvol.MinChunk[axis] = floorDiv(subvol.MinPoint[axis], block[axis])
+			subvol.MaxChunk[axis] = floorDiv(subvol.MaxPoint[axis], block[axis])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// expand runs RunExpand on the output of Run, failing the test on error.
+func expand(t *testing.T, input string, opts Options) []Span {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := RunExpand(strings.NewReader(run(t, input, opts)), &buf); err != nil {
+		t.Fatalf("error expanding: %s", err.Error())
+	}
+	var spans []Span
+	if err := json.Unmarshal(buf.Bytes(), &spans); err != nil {
+		t.Fatalf("error parsing expanded spans: %s", err.Error())
+	}
+	return spans
+}
+
+func TestExpandRoundTrip(t *testing.T) {
+	spans := []Span{{0, 0, 0, 40}, {0, 0, 100, 130}, {0, 20, 0, 5}, {40, 40, 40, 40}}
+	opts := testOptions()
+	opts.BatchSize = Point3d{8, 8, 8}
+	want := Expand(partition(t, spans, opts))
+
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"default", func(*Options) {}},
+		{"half-open", func(opts *Options) { opts.HalfOpen = true }},
+		{"block units", func(opts *Options) { opts.Units = blockUnits }},
+		{"voxel units", func(opts *Options) { opts.Units = voxelUnits }},
+		{"half-open voxel units", func(opts *Options) { opts.HalfOpen = true; opts.Units = voxelUnits }},
+		{"anisotropic voxel units", func(opts *Options) { opts.BlockSize = Point3d{32, 16, 40}; opts.Units = voxelUnits }},
+	}
+	for _, test := range tests {
+		opts := opts
+		test.edit(&opts)
+		if got := expand(t, testSpansJSON, opts); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expanded to %v, want %v", test.name, got, want)
+		}
+	}
+
+	// The same holds piping the CLI's output into its expand command.
+	for _, args := range [][]string{{"-batchsize", "8"}, {"-batchsize", "8", "-half-open", "-units", "voxels"}} {
+		output, stderr, status := runCLI(t, testSpansJSON, args...)
+		if status != 0 {
+			t.Fatalf("partition %v: exit status %d: %s", args, status, stderr)
+		}
+		expanded, stderr, status := runCLI(t, output, "expand")
+		if status != 0 {
+			t.Fatalf("partition %v | partition expand: exit status %d: %s", args, status, stderr)
+		}
+		var got []Span
+		if err := json.Unmarshal([]byte(expanded), &got); err != nil {
+			t.Fatalf("error parsing expanded spans %q: %s", expanded, err.Error())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("partition %v | partition expand: expanded to %v, want %v", args, got, want)
+		}
+	}
+
+	// Every input block is covered.
+	covered := map[Span]bool{}
+	for _, span := range want {
+		for x := span[2]; x <= span[3]; x++ {
+			covered[Span{span[0], span[1], x, x}] = true
+		}
+	}
+	for _, span := range spans {
+		for x := span[2]; x <= span[3]; x++ {
+			if !covered[Span{span[0], span[1], x, x}] {
+				t.Errorf("block (%d, %d, %d) is not covered", x, span[1], span[0])
+			}
+		}
+	}
+}
+
+func TestExpandNoBlockExtents(t *testing.T) {
+	input := `{"Subvolumes": [{"MinPoint": [0, 0, 0], "MaxPoint": [63, 63, 63]}]}`
+	if err := RunExpand(strings.NewReader(input), &bytes.Buffer{}); err == nil {
+		t.Errorf("voxel extents without a block size: got no error")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fillBuckets is the number of equal fill fraction ranges in the histogram
+// logged by logFillHistogram.
+const fillBuckets = 10
+
+// histogramWidth is the length of the bar of the fullest bucket.
+const histogramWidth = 50
+
+// logFillHistogram logs the number of subvolumes within each range of fill
+// fraction, so batch sizes yielding mostly near-empty subvolumes stand out.
+func (opts Options) logFillHistogram(subvols []subvolumeT) {
+	if !opts.logging(LogInfo) || len(subvols) == 0 {
+		return
+	}
+	var counts [fillBuckets]int
+	for _, subvol := range subvols {
+		bucket := int(subvol.FillFraction * fillBuckets)
+		if bucket >= fillBuckets {
+			bucket = fillBuckets - 1
+		}
+		counts[bucket]++
+	}
+	largest := 0
+	for _, count := range counts {
+		if count > largest {
+			largest = count
+		}
+	}
+	opts.logf("Subvolumes by fill fraction:")
+	for i, count := range counts {
+		bar := strings.Repeat("#", (count*histogramWidth+largest-1)/largest)
+		line := fmt.Sprintf("  %.1f-%.1f %8d %s", float64(i)/fillBuckets, float64(i+1)/fillBuckets, count, bar)
+		opts.logf("%s", strings.TrimRight(line, " "))
+	}
+}
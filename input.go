@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// spanDecoder decodes spans from r, passing each span to fn as it is read.
+// Malformed spans that the decoder can continue past are passed to bad, which
+// returns nil to skip them or an error to stop decoding.
+type spanDecoder func(r io.Reader, fn func(Span) error, bad func(error) error) error
+
+// spanDecoders maps each input format to its decoder.
+var spanDecoders = map[string]spanDecoder{
+	"json":    decodeSpans,
+	"ndjson":  decodeNDJSONSpans,
+	"csv":     decodeCSVSpans,
+	"dvidrle": decodeDVIDRLESpans,
+	"points":  decodePoints,
+}
+
+// gzipMagic is the two-byte header that starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader of the decompressed data if r holds a gzip
+// stream, or the unchanged data otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading input: %s", err.Error())
+	}
+	if len(header) < len(gzipMagic) || header[0] != gzipMagic[0] || header[1] != gzipMagic[1] {
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("error reading gzip input: %s", err.Error())
+	}
+	return zr, nil
+}
+
+// decodeSpans reads a JSON array of spans from r one element at a time,
+// passing each to fn, so the whole input never needs to be held in memory.
+func decodeSpans(r io.Reader, fn func(Span) error, bad func(error) error) error {
+	return decodeJSONArray(r, fn, bad)
+}
+
+// decodeJSONArray reads a JSON array from r one element at a time, passing
+// each to fn.  Elements rejected with a *spanError are passed to bad.
+func decodeJSONArray[T any](r io.Reader, fn func(T) error, bad func(error) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("error parsing JSON: %s", err.Error())
+	}
+	if tok == nil {
+		// A JSON null is an empty list of spans.
+		return expectEOF(dec)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("error parsing JSON: expected an array of spans, got %v", tok)
+	}
+	for i := 0; dec.More(); i++ {
+		var elem T
+		if err := dec.Decode(&elem); err != nil {
+			if _, ok := err.(*spanError); !ok {
+				return fmt.Errorf("error parsing JSON for span %d: %s", i, err.Error())
+			}
+			if err := bad(fmt.Errorf("span %d: %s", i, err.Error())); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("error parsing JSON: %s", err.Error())
+	}
+	return expectEOF(dec)
+}
+
+// expectEOF returns an error if anything but whitespace follows the decoded
+// JSON value.
+func expectEOF(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return fmt.Errorf("error parsing JSON: unexpected data after span list")
+		}
+		return fmt.Errorf("error parsing JSON: %s", err.Error())
+	}
+	return nil
+}
+
+// decodeNDJSONSpans reads one JSON span per line from r, skipping blank lines.
+func decodeNDJSONSpans(r io.Reader, fn func(Span) error, bad func(error) error) error {
+	return decodeNDJSON(r, fn, bad)
+}
+
+// decodeNDJSON reads one JSON value per line from r, skipping blank lines.
+func decodeNDJSON[T any](r io.Reader, fn func(T) error, bad func(error) error) error {
+	br := bufio.NewReader(r)
+	for lineNum := int64(1); ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error reading line %d: %s", lineNum, err.Error())
+		}
+		if text := strings.TrimSpace(line); text != "" {
+			var elem T
+			if err := json.Unmarshal([]byte(text), &elem); err != nil {
+				if err := bad(fmt.Errorf("error parsing JSON on line %d: %s", lineNum, err.Error())); err != nil {
+					return err
+				}
+			} else if err := fn(elem); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// decodeCSVSpans reads one z,y,x0,x1 span per CSV row from r.  The first row is
+// skipped as a header if its first field is not an integer.
+func decodeCSVSpans(r io.Reader, fn func(Span) error, bad func(error) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(Span{})
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	for rowNum := 1; ; rowNum++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if perr, ok := err.(*csv.ParseError); ok && perr.Err == csv.ErrFieldCount {
+			if err := bad(fmt.Errorf("error parsing CSV row %d (line %d): expected %d fields, got %d",
+				rowNum, perr.Line, len(Span{}), len(record))); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing CSV: %s", err.Error())
+		}
+		var span Span
+		for i, field := range record {
+			span[i], err = strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if rowNum == 1 {
+				if _, headerErr := strconv.Atoi(strings.TrimSpace(record[0])); headerErr != nil {
+					continue
+				}
+			}
+			line, _ := cr.FieldPos(0)
+			if err := bad(fmt.Errorf("error parsing CSV row %d (line %d): %s", rowNum, line, err.Error())); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(span); err != nil {
+			return err
+		}
+	}
+}
+
+// spanError describes a JSON value that is not a valid span.
+type spanError struct {
+	value  string
+	reason string
+}
+
+func (e *spanError) Error() string {
+	return fmt.Sprintf("%s is not a span: %s", e.value, e.reason)
+}
+
+// maxErrorValueLen is the number of bytes of a malformed value to include in
+// an error message.
+const maxErrorValueLen = 64
+
+func newSpanError(data []byte, reason string) *spanError {
+	value := string(bytes.TrimSpace(data))
+	if len(value) > maxErrorValueLen {
+		value = value[:maxErrorValueLen] + "..."
+	}
+	return &spanError{value, reason}
+}
+
+// tupleElements returns the elements of data, which must be a JSON array of n
+// values.
+func tupleElements(data []byte, n int) ([]json.RawMessage, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil || values == nil {
+		return nil, newSpanError(data, fmt.Sprintf("expected an array of %d integers", n))
+	}
+	if len(values) != n {
+		return nil, newSpanError(data, fmt.Sprintf("expected %d integers, got %d elements", n, len(values)))
+	}
+	return values, nil
+}
+
+// parseInts parses each of values as an integer into dst.  Errors number the
+// elements of data starting from first.
+func parseInts(data []byte, values []json.RawMessage, dst []int64, first int) error {
+	for i, value := range values {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return newSpanError(data, fmt.Sprintf("element %d is not an integer", first+i))
+		}
+		dst[i] = n
+	}
+	return nil
+}
+
+// UnmarshalJSON requires span to be an array of exactly four integers.
+func (span *Span) UnmarshalJSON(data []byte) error {
+	values, err := tupleElements(data, len(span))
+	if err != nil {
+		return err
+	}
+	return parseInts(data, values, span[:], 0)
+}
+
+// UnmarshalJSON requires span to be an array of a label followed by the four
+// integers of a span.
+func (span *LabeledSpan) UnmarshalJSON(data []byte) error {
+	values, err := tupleElements(data, 1+len(span.Span))
+	if err != nil {
+		return err
+	}
+	if span.Label, err = strconv.ParseUint(string(values[0]), 10, 64); err != nil {
+		return newSpanError(data, "element 0 is not a label")
+	}
+	return parseInts(data, values[1:], span.Span[:], 1)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestMalformedSpans(t *testing.T) {
+	tests := []struct {
+		name, elem, err string
+	}{
+		{"too few", `[0,0,0]`, "span 1: [0,0,0] is not a span: expected 4 integers, got 3 elements"},
+		{"too many", `[0,0,0,1,2]`, "span 1: [0,0,0,1,2] is not a span: expected 4 integers, got 5 elements"},
+		{"string", `[0,"a",0,1]`, `span 1: [0,"a",0,1] is not a span: element 1 is not an integer`},
+		{"float", `[0,0,0.5,1]`, "span 1: [0,0,0.5,1] is not a span: element 2 is not an integer"},
+		{"nested", `[[0],0,0,1]`, "span 1: [[0],0,0,1] is not a span: element 0 is not an integer"},
+		{"object", `{"z":1}`, `span 1: {"z":1} is not a span: expected an array of 4 integers`},
+	}
+	for _, test := range tests {
+		input := `[[0,0,0,1],` + test.elem + `,[0,1,0,2]]`
+		err := Run(t.Context(), strings.NewReader(input), &bytes.Buffer{}, testOptions())
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+
+		// With SkipBad the other spans are still partitioned.
+		var logBuf bytes.Buffer
+		opts := testOptions()
+		opts.SkipBad = true
+		opts.Logger = log.New(&logBuf, "", 0)
+		opts.Summary = true
+		if got, want := run(t, input, opts), `"NumActiveBlocks": 5,`; !strings.Contains(got, want) {
+			t.Errorf("%s: skipping bad spans wrote %s, want %s", test.name, got, want)
+		}
+		if !strings.Contains(logBuf.String(), test.err) {
+			t.Errorf("%s: got log %q, want %q", test.name, logBuf.String(), test.err)
+		}
+	}
+
+	// Skipped spans are counted in the positions of later spans.
+	opts := testOptions()
+	opts.SkipBad = true
+	opts.Reversed = RejectReversed
+	opts.Logger = log.New(&bytes.Buffer{}, "", 0)
+	err := Run(t.Context(), strings.NewReader(`[[0,0,0],[0,0,5,1]]`), &bytes.Buffer{}, opts)
+	if want := "span 1 [0 0 5 1] has X0 > X1"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// LabeledSpan is a span of blocks belonging to the segment Label.  It is
+// encoded in JSON as [label, z, y, x0, x1].
+type LabeledSpan struct {
+	Label uint64
+	Span
+}
+
+// labeledSpanDecoders maps each input format supporting labeled spans to its
+// decoder.
+var labeledSpanDecoders = map[string]func(io.Reader, func(LabeledSpan) error, func(error) error) error{
+	"json":   decodeJSONArray[LabeledSpan],
+	"ndjson": decodeNDJSON[LabeledSpan],
+}
+
+// PartitionLabeled partitions the spans of each label separately, returning
+// the subvolumes of each label.
+func PartitionLabeled(ctx context.Context, spans []LabeledSpan, opts Options) (map[uint64]subvolumesT, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	accs, err := accumulateLabeled(ctx, opts, func(fn func(LabeledSpan) error, skip func()) error {
+		for _, span := range spans {
+			if err := fn(span); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return labeledSubvolumes(accs), nil
+}
+
+// runLabeled is RunSources for opts.Labeled.
+func runLabeled(ctx context.Context, sources []Source, w io.Writer, opts Options) error {
+	accs, err := accumulateLabeled(ctx, opts, func(fn func(LabeledSpan) error, skip func()) error {
+		return opts.decodeSources(sources, func(r io.Reader) error {
+			return labeledSpanDecoders[opts.inputFormat()](r, fn, opts.skipBad(skip))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	labeled := labeledSubvolumes(accs)
+	if opts.FailOnEmpty && labeledEmpty(labeled) {
+		return ErrEmpty
+	}
+	return writeJSON(w, labeledOutput(labeled))
+}
+
+// labeledOutput is written as a JSON object mapping each label to its
+// partition.
+type labeledOutput map[uint64]subvolumesT
+
+// MarshalJSON writes the labels in increasing numeric order, where
+// encoding/json would sort them as strings and put 10 before 9.
+func (labeled labeledOutput) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, label := range slices.Sorted(maps.Keys(labeled)) {
+		data, err := json.Marshal(labeled[label])
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `"%d":`, label)
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// labeledEmpty returns true if no label has any subvolumes.
+func labeledEmpty(labeled map[uint64]subvolumesT) bool {
+	for _, subvolumes := range labeled {
+		if subvolumes.NumSubvolumes > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// accumulateLabeled adds every span passed to fn by produce to the accumulator
+// for its label.  produce calls skip for each malformed span it skips.
+func accumulateLabeled(ctx context.Context, opts Options, produce func(fn func(LabeledSpan) error, skip func()) error) (map[uint64]*accumulator, error) {
+	opts.Origin = opts.alignedOrigin()
+	accs := make(map[uint64]*accumulator)
+	var index int64
+	progress := progress{ctx: ctx, opts: opts}
+	exclude := newExclusion(opts.Exclude)
+	err := produce(func(labeled LabeledSpan) error {
+		span, ok, err := opts.checkSpan(index, labeled.Span)
+		index++
+		if !ok {
+			return err
+		}
+		if err := progress.add(span); err != nil {
+			return err
+		}
+		acc, found := accs[labeled.Label]
+		if !found {
+			acc = newAccumulator(opts)
+			accs[labeled.Label] = acc
+		}
+		err = exclude.subtract(span, acc.add)
+		if err != nil {
+			return fmt.Errorf("label %d: %s", labeled.Label, err.Error())
+		}
+		return nil
+	}, func() { index++ })
+	progress.done()
+	if err != nil {
+		return nil, err
+	}
+	for label, acc := range accs {
+		if err := acc.finish(); err != nil {
+			return nil, fmt.Errorf("label %d: %s", label, err.Error())
+		}
+	}
+	return accs, nil
+}
+
+func labeledSubvolumes(accs map[uint64]*accumulator) map[uint64]subvolumesT {
+	labeled := make(map[uint64]subvolumesT, len(accs))
+	for label, acc := range accs {
+		labeled[label] = acc.subvolumes()
+	}
+	return labeled
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogLevel is the least severe level of diagnostic messages written to
+// Options.Logger.  The zero value writes them all.
+type LogLevel int
+
+const (
+	// LogDebug adds progress and timing details.
+	LogDebug LogLevel = iota
+
+	// LogInfo adds the parameters used and the final counts.
+	LogInfo
+
+	// LogWarn adds skipped or altered input.
+	LogWarn
+
+	// LogError writes only errors.
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (level LogLevel) String() string {
+	if level < LogDebug || level > LogError {
+		return fmt.Sprintf("LogLevel(%d)", int(level))
+	}
+	return logLevelNames[level]
+}
+
+// parseLogLevel returns the level named s, as in logLevelNames.
+func parseLogLevel(s string) (LogLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return LogLevel(level), nil
+		}
+	}
+	return 0, fmt.Errorf("must be one of %s, got %q", strings.Join(logLevelNames, ", "), s)
+}
+
+// logAt writes a message to opts.Logger, prefixed by its level, if it is at
+// least opts.LogLevel.
+func (opts Options) logAt(level LogLevel, format string, args ...interface{}) {
+	if opts.Logger != nil && level >= opts.LogLevel {
+		opts.Logger.Printf(strings.ToUpper(level.String())+" "+format, args...)
+	}
+}
+
+func (opts Options) debugf(format string, args ...interface{}) {
+	opts.logAt(LogDebug, format, args...)
+}
+
+func (opts Options) logf(format string, args ...interface{}) {
+	opts.logAt(LogInfo, format, args...)
+}
+
+func (opts Options) warnf(format string, args ...interface{}) {
+	opts.logAt(LogWarn, format, args...)
+}
+
+// logging returns true if messages at level are written.
+func (opts Options) logging(level LogLevel) bool {
+	return opts.Logger != nil && level >= opts.LogLevel
+}
+
+// phaseTimer records the durations of the consecutive phases of a run, logged
+// at debug level.  A nil timer records nothing.
+type phaseTimer struct {
+	last      time.Time
+	phases    []string
+	durations []time.Duration
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{last: time.Now()}
+}
+
+// done ends the named phase, which began when the previous one ended.
+func (t *phaseTimer) done(phase string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.phases = append(t.phases, phase)
+	t.durations = append(t.durations, now.Sub(t.last))
+	t.last = now
+}
+
+func (t *phaseTimer) log(opts Options) {
+	if t == nil {
+		return
+	}
+	var total time.Duration
+	timings := make([]string, len(t.phases))
+	for i, phase := range t.phases {
+		timings[i] = fmt.Sprintf("%s %s", phase, t.durations[i].Round(time.Microsecond))
+		total += t.durations[i]
+	}
+	opts.debugf("Timing: %s, total %s", strings.Join(timings, ", "), total.Round(time.Microsecond))
+}
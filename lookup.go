@@ -0,0 +1,51 @@
+package main
+
+// indexCells records the index of each subvolume that is a single grid cell,
+// so SubvolumeAt finds them from the grid math.
+func (subvolumes *subvolumesT) indexCells() {
+	subvolumes.index = make(map[Point3d]int, len(subvolumes.Subvolumes))
+	for i, subvol := range subvolumes.Subvolumes {
+		if subvol.cell != nil {
+			subvolumes.index[*subvol.cell] = i
+		}
+	}
+}
+
+// SubvolumeAt returns the index in Subvolumes of the subvolume containing
+// block, or false if block is in a pruned or empty region.  A block in the
+// halo of another subvolume belongs to the subvolume of its own grid cell.
+//
+// Grid cells are found in constant time.  Subvolumes that are not single grid
+// cells, such as merged subvolumes, those of other modes, and those decoded
+// from JSON, are searched in turn.
+func (subvolumes subvolumesT) SubvolumeAt(block Point3d) (int, bool) {
+	params := subvolumes.Params
+	if subvolumes.index != nil && params.BatchSize != (Point3d{}) {
+		var cell Point3d
+		for i := range cell {
+			cell[i] = floorDiv(block[i]-params.Origin[i], params.BatchSize[i])
+		}
+		if i, found := subvolumes.index[cell]; found {
+			return i, true
+		}
+		if len(subvolumes.index) == len(subvolumes.Subvolumes) {
+			return 0, false
+		}
+	}
+	for i, subvol := range subvolumes.Subvolumes {
+		if subvol.cell == nil && subvol.contains(block) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// contains returns true if block is within the chunk extents of subvol.
+func (subvol subvolumeT) contains(block Point3d) bool {
+	for i := range block {
+		if block[i] < subvol.MinChunk[i] || block[i] > subvol.MaxChunk[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSubvolumeAt(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"grid", func(*Options) {}},
+		{"origin", func(opts *Options) { opts.Origin = Point3d{3, -5, 7} }},
+		{"pruned", func(opts *Options) { opts.MinActiveBlocks = 3 }},
+		{"merged", func(opts *Options) { opts.MergeMax = 100 }},
+		{"octree", func(opts *Options) { opts.Mode = "octree"; opts.LeafMax = 8 }},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.edit(&opts)
+		subvolumes := partition(t, adjacencySpans, opts)
+
+		// A block outside the chunk extents of every subvolume is in none.
+		want := func(block Point3d) (int, bool) {
+			for i, subvol := range subvolumes.Subvolumes {
+				if subvol.contains(block) {
+					return i, true
+				}
+			}
+			return 0, false
+		}
+		check := func(name string, subvolumes subvolumesT) {
+			for i, subvol := range subvolumes.Subvolumes {
+				// The corners of each subvolume and the blocks just outside them.
+				for _, corner := range []Point3d{subvol.MinChunk, subvol.MaxChunk} {
+					if got, found := subvolumes.SubvolumeAt(corner); !found || got != i {
+						t.Errorf("%s, %s: block %v is in subvolume %d, %t, want %d", test.name, name, corner, got, found, i)
+					}
+					for axis := range corner {
+						for _, step := range []int64{-1, 1} {
+							block := corner
+							block[axis] += step
+							wantIndex, wantFound := want(block)
+							if got, found := subvolumes.SubvolumeAt(block); found != wantFound || got != wantIndex {
+								t.Errorf("%s, %s: block %v is in subvolume %d, %t, want %d, %t", test.name, name, block, got, found, wantIndex, wantFound)
+							}
+						}
+					}
+				}
+			}
+		}
+		check("partitioned", subvolumes)
+
+		// Decoded subvolumes are searched by their extents.
+		var decoded subvolumesT
+		if err := json.Unmarshal([]byte(encode(t, subvolumes)), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		check("decoded", decoded)
+	}
+
+	// A block in a halo belongs to the subvolume of its own grid cell.
+	opts := testOptions()
+	opts.Halo = 32
+	subvolumes := partition(t, adjacencySpans, opts)
+	for _, block := range []Point3d{{15, 0, 0}, {16, 0, 0}, {-1, 0, 0}} {
+		got, found := subvolumes.SubvolumeAt(block)
+		if wantFound := block[0] >= 0; found != wantFound {
+			t.Errorf("halo: block %v is in a subvolume: %t, want %t", block, found, wantFound)
+		} else if found && subvolumes.Subvolumes[got].Key != chunkKey(opts.cellChunks(opts.cell(block)).MinChunk) {
+			t.Errorf("halo: block %v is in subvolume %s", block, subvolumes.Subvolumes[got].Key)
+		}
+	}
+}
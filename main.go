@@ -1,43 +1,372 @@
-// Command-line interface to a remote DVID server.
-// Provides essential commands on top of core http server: init, serve, repair.
+// Command partition splits the block spans of a volume into subvolumes, and
+// provides commands to expand, validate and post them to DVID.
 
 package main
 
 import (
-	"encoding/json"
+	"compress/gzip"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 var (
-	batchsize = flag.Int("batchsize", 16, "")
-	blocksize = flag.Int("blocksize", 32, "")
+	batchsize = flag.Int64("batchsize", 16, "")
+	blocksize = flag.Int64("blocksize", 32, "")
+
+	// Per-axis batch sizes override batchsize if non-zero.
+	batchsizeX = flag.Int64("batchsize-x", 0, "")
+	batchsizeY = flag.Int64("batchsize-y", 0, "")
+	batchsizeZ = flag.Int64("batchsize-z", 0, "")
+
+	// Voxels along each axis of a substack, replacing the batch sizes if
+	// non-zero.
+	subvolumeVoxels = flag.Int64("subvolume-voxels", 0, "")
+
+	// Per-axis block sizes override blocksize if non-zero.
+	blocksizeX = flag.Int64("blocksize-x", 0, "")
+	blocksizeY = flag.Int64("blocksize-y", 0, "")
+	blocksizeZ = flag.Int64("blocksize-z", 0, "")
+
+	// Skip all voxel computation, making the block size unused.
+	noVoxels = flag.Bool("no-voxels", false, "")
+
+	// Prune subvolumes with fewer active blocks.
+	minActiveBlocks = flag.Int64("min-active-blocks", 0, "")
+
+	// Block coordinate of the grid origin along each axis.
+	originX = flag.Int64("origin-x", 0, "")
+	originY = flag.Int64("origin-y", 0, "")
+	originZ = flag.Int64("origin-z", 0, "")
+
+	// Voxel multiple that subvolume boundaries are aligned to.
+	align = flag.Int("align", 0, "")
+
+	// Voxel multiple that subvolumes are split at so none straddles it.
+	chunkAlign = flag.Int("chunk-align", 0, "")
+
+	// Voxels of padding added to each side of a subvolume.
+	halo = flag.Int("halo", 0, "")
+
+	// Maximum number of subvolumes along each axis, or 0 for no limit.
+	gridSize = flag.Int("grid-size", 0, "")
+
+	// File of spans whose blocks are excluded from the partition.
+	excludePath = flag.String("exclude", "", "")
+
+	// Block bounding box "z0,y0,x0,z1,y1,x1" spans are clipped to.
+	bbox = flag.String("bbox", "", "")
+
+	// Voxel resolution "x,y,z" in nanometers echoed into the output.
+	resolution = flag.String("resolution", "", "")
+
+	// Axis along which input spans run.
+	runAxis = flag.String("run-axis", "x", "")
+
+	// Treat X1 as the exclusive end of each span.
+	exclusiveX = flag.Bool("exclusive-x", false, "")
+
+	// Read [z, y, x0, x1, weight] spans and report subvolume weights.
+	weighted = flag.Bool("weighted", false, "")
+
+	// Swap X0 and X1 of spans with X0 > X1, or make them an error.
+	swapReversed   = flag.Bool("swap-reversed", false, "")
+	rejectReversed = flag.Bool("reject-reversed", false, "")
+
+	// Read spans as [label, z, y, x0, x1] and partition each label separately.
+	labeled = flag.Bool("labeled", false, "")
+
+	// Skip malformed spans instead of exiting.
+	skipBad = flag.Bool("skip-bad", false, "")
+
+	// Count blocks covered by more than one span only once.
+	dedup = flag.Bool("dedup", false, "")
+
+	// Treat span coordinates as voxels instead of blocks.
+	voxelCoords = flag.Bool("voxel-coords", false, "")
+
+	// Number of goroutines ingesting spans, or 0 for one per CPU.
+	parallel = flag.Int("parallel", 0, "")
+
+	// Approximate number of subvolumes, replacing the batch size if positive.
+	targetSubvolumes = flag.Int("target-subvolumes", 0, "")
+
+	// Partitioning mode, the maximum active blocks in an octree leaf, and the
+	// number of rcb partitions.
+	mode       = flag.String("mode", "grid", "")
+	leafMax    = flag.Int64("leaf-max", 0, "")
+	partitions = flag.Int("partitions", 0, "")
+
+	// Merge adjacent subvolumes while their active blocks are at most mergeMax.
+	merge    = flag.Bool("merge", false, "")
+	mergeMax = flag.Int64("merge-max", 0, "")
+
+	// Split subvolumes with more active blocks than this.
+	maxActiveBlocks = flag.Int64("max-active-blocks", 0, "")
+
+	// Report the face-adjacent subvolumes of each subvolume.
+	adjacency = flag.Bool("adjacency", false, "")
+
+	// Label connected components of face-adjacent subvolumes.
+	components = flag.Bool("components", false, "")
+
+	// Report the coalesced spans of the active blocks of each subvolume.
+	coalesceOutput = flag.Bool("coalesce-output", false, "")
+
+	// Check that every active block is in exactly one subvolume.
+	assertCover = flag.Bool("assert-cover", false, "")
+
+	// Report the active blocks of each subvolume on its boundary.
+	boundary = flag.Bool("boundary", false, "")
+
+	// Extents reported for each subvolume.
+	units = flag.String("units", "both", "")
+
+	// Report maximum extents as exclusive bounds.
+	halfOpen = flag.Bool("half-open", false, "")
+
+	// Order of the output subvolumes.
+	order = flag.String("order", "scan", "")
+
+	// JSON file of Options fields used for flags not on the command line.
+	configPath = flag.String("config", "", "")
+
+	// Read spans from this file instead of stdin if non-empty.
+	inputPath = flag.String("input", "", "")
+
+	// Format of the span input.
+	inputFormat = flag.String("format", "json", "")
+
+	// JSON pointer to spans embedded in a JSON envelope, and their encoding.
+	jsonPointer      = flag.String("json-pointer", "", "")
+	embeddedEncoding = flag.String("embedded-encoding", "base64", "")
+
+	// Half-width of the cube around each point of points input.
+	radius = flag.Int64("radius", 0, "")
+
+	// Write results to this file instead of stdout if non-empty.
+	outputPath = flag.String("output", "", "")
+
+	// Format of the output, and the scale of dvidtiles output.
+	outputFormat = flag.String("output-format", "json", "")
+	scale        = flag.Int("scale", 0, "")
+
+	// Only output summary counts if true.
+	summaryOnly = flag.Bool("summary", false, "")
+
+	// Exit with an error if there are no subvolumes.
+	failOnEmpty = flag.Bool("fail-on-empty", false, "")
+
+	// Print a quick estimate to stderr instead of partitioning if true.
+	estimate = flag.Bool("estimate", false, "")
+
+	// Output how much the spans overlap instead of partitioning if true.
+	overlapReport = flag.Bool("overlap-report", false, "")
+
+	// Only output block and subvolume counts if true.
+	countOnly = flag.Bool("count-only", false, "")
+
+	// Output points as {"X", "Y", "Z"} objects instead of arrays if true.
+	namedPoints = flag.Bool("named-points", false, "")
+
+	// Indent JSON output by this many spaces if pretty is true.
+	pretty = flag.Bool("pretty", true, "")
+	indent = flag.Int("indent", 4, "")
+
+	// Write each subvolume to its own file in this directory.
+	splitDir = flag.String("split-dir", "", "")
+
+	// Write each subvolume of JSON output as it is produced.
+	stream = flag.Bool("stream", false, "")
+
+	// Gzip the output.  Implied by an output path ending in ".gz".
+	gzipOutput = flag.Bool("gzip-output", false, "")
+
+	// Print the version and exit if true.
+	showVersion = flag.Bool("version", false, "")
 
 	// Display usage if true.
 	showHelp = flag.Bool("help", false, "")
 
 	// Run in verbose mode if true.
 	runVerbose = flag.Bool("verbose", false, "")
+
+	// Least severe level of diagnostic messages, and suppress them all if quiet.
+	logLevel = flag.String("log-level", "", "")
+	quiet    = flag.Bool("quiet", false, "")
 )
 
 const helpMessage = `
 partition reads a JSON-encoded list of block spans and creates subvolumes.
 
-Usage: partition [options] <command>
+Usage: partition [options] [command] [command options] [input files]
+
+Spans are read from standard input unless input files are given, in which case
+the spans of all the files are partitioned together.
+
+Commands:
+
+      partition   Partition spans into subvolumes (default)
+      bbox        Write the bounding box and number of active blocks of the spans
+      expand      Read subvolumes output by partition and write the spans of blocks they cover
+      help        Show this help message, or with a command name, the help of that command
+      post        Post the active blocks as spans to a DVID ROI instance
+      validate    Check the input spans without partitioning them and report the first errors
+      version     Show version, git commit and build date
+
+Options:
 
       -batchsize  =number   Number of blocks along one axis of a substack (default 16)
+      -batchsize-x, -batchsize-y, -batchsize-z
+                  =number   Number of blocks along that axis of a substack (default batchsize)
+      -subvolume-voxels =number
+                            Number of voxels along each axis of a substack instead of
+                            -batchsize; must be a multiple of the block size
       -blocksize  =number   Number of voxels along one axis of a block (default 32)
-      -verbose    (flag)    Run in verbose mode.
+      -blocksize-x, -blocksize-y, -blocksize-z
+                  =number   Number of voxels along that axis of a block (default blocksize)
+      -no-voxels  (flag)    Compute and report only block extents and counts, omitting
+                            voxel extents, NumActiveVoxels and the block size, so no
+                            -blocksize is needed (implies -units blocks)
+      -origin-x, -origin-y, -origin-z
+                  =number   Block coordinate along that axis where subvolume boundaries start (default 0)
+      -align      =number   Move the origin back until every subvolume starts on a multiple of
+                            this many voxels (default 0, no alignment)
+      -chunk-align
+                  =number   Split subvolumes at every multiple of this many voxels along each
+                            axis, so none straddles a storage chunk of that size; must be a
+                            multiple of the block size (default 0, no splitting)
+      -min-active-blocks
+                  =number   Prune subvolumes with fewer active blocks (default 0)
+      -halo       =number   Voxels of padding added to each side of a subvolume, clamped to
+                            the bounding box of all subvolumes (default 0).  Block counts
+                            still describe the unpadded subvolume.
+      -grid-size  =number   Maximum number of subvolumes along each axis from the origin;
+                            spans outside this grid are an error (default 0, no limit)
+      -bbox       =string   Clip spans to the block bounding box "z0,y0,x0,z1,y1,x1" (inclusive),
+                            dropping spans outside it
+      -resolution =string   Voxel resolution "x,y,z" in nanometers, reported as Resolution
+                            in the output summary
+      -exclude    =string   Read spans in the input format from this file and exclude the
+                            blocks they cover from the partition
+      -swap-reversed (flag) Swap X0 and X1 of spans with X0 > X1 instead of skipping them
+      -reject-reversed (flag)
+                            Exit with an error on spans with X0 > X1 instead of skipping them
+      -exclusive-x (flag)   Treat X1 as the exclusive end of each span, so a span covers
+                            blocks X0 to X1-1 (after any -swap-reversed)
+      -run-axis   =string   Axis the input spans run along: x (default) for [z, y, x0, x1],
+                            y for [z, x, y0, y1] or z for [x, y, z0, z1]
+      -labeled    (flag)    Read [label, z, y, x0, x1] spans and output an object mapping
+                            each label to its partition (json or ndjson input only)
+      -weighted   (flag)    Read [z, y, x0, x1, weight] spans, where each block costs weight,
+                            and report the TotalWeight of each subvolume (json or ndjson input)
+      -skip-bad   (flag)    Skip malformed spans instead of exiting with an error
+      -dedup      (flag)    Count blocks covered by more than one span once and report
+                            the number of duplicate coverings as DuplicateBlocks; the
+                            number of overlapping or adjacent spans merged is logged with -verbose
+      -voxel-coords (flag)  Treat span coordinates as voxels and convert them to blocks using
+                            the block size.  Implies -dedup.
+      -parallel   =number   Number of goroutines ingesting spans (default 0, one per CPU)
+      -target-subvolumes =number
+                            Choose a cubic batch size giving about this many non-empty
+                            subvolumes instead of using -batchsize (reported with -verbose);
+                            approximate, as the closest of the sizes tried is used
+      -mode       =string   Partitioning mode: grid (default), octree or rcb (recursive
+                            coordinate bisection into pieces with equal active blocks)
+      -leaf-max   =number   Maximum active blocks in an octree leaf (required by -mode octree)
+      -partitions =number   Number of pieces to bisect into (required by -mode rcb)
+      -merge      (flag)    Merge runs of adjacent subvolumes with the same cross-section
+      -merge-max  =number   Maximum active blocks in a merged subvolume (required by -merge)
+      -max-active-blocks =number
+                            Halve subvolumes with more active blocks than this along their
+                            longest axis until no piece has more (default 0, no limit)
+      -adjacency  (flag)    Report the indices of the face-adjacent subvolumes of each
+                            subvolume as Adjacency (grid mode and json output only)
+      -components (flag)    Number each subvolume's connected component of face-adjacent
+                            subvolumes and report NumComponents (grid mode and json only)
+      -coalesce-output (flag)
+                            Report the coalesced spans of the active blocks within each
+                            subvolume as its Spans, in block coordinates (json only)
+      -assert-cover (flag)  Check that every active block is in exactly one subvolume, and exit
+                            with an error naming the first block that is not
+      -boundary   (flag)    Report the active blocks of each subvolume sharing a face with an
+                            active block of another as BoundaryBlocks (grid mode only)
+      -units      =string   Extents reported for each subvolume: both (default), blocks
+                            (only chunk extents) or voxels (only voxel extents)
+      -half-open  (flag)    Report MaxPoint and MaxChunk one past the last voxel and block,
+                            as half-open [min, max) boxes (json and csv only)
+      -order      =string   Order of output subvolumes: scan (z, y, x), morton (Z-order) or
+                            active-desc (most active blocks first, ties in scan order)
+                            Output is the same for the same spans and options, whatever
+                            the order of the spans or -parallel
+      -config     =string   Read options from this JSON file of Options fields, e.g.
+                            {"BatchSize": [16, 16, 8], "Origin": [0, 0, 4], "Mode": "grid"};
+                            flags on the command line take precedence
+      -input      =string   Read spans from this file, in addition to any input files;
+                            gzipped input is decompressed automatically
+      -format     =string   Input format: json (an array of spans), ndjson (one span per line),
+                            csv (z,y,x0,x1 rows with an optional header row), dvidrle
+                            (DVID binary sparse volume RLE, usually with -voxel-coords), or
+                            points (an array of [z,y,x] points, each the center of a cube)
+      -json-pointer
+                  =string   Read the spans embedded in a JSON document at this JSON pointer,
+                            e.g. /spans; a string value is decoded with -embedded-encoding
+      -embedded-encoding =string
+                            Encoding of embedded spans: base64 (default) or none, either
+                            optionally gzipped
+      -radius     =number   Half-width of the cube of blocks around each point of points
+                            input (default 0, the point's block only)
+      -output     =string   Write results to this file instead of standard output
+      -split-dir  =string   Write each subvolume to subvolume_<ID>.json in this directory,
+                            and an index.json listing them, instead of the output (json only)
+      -stream     (flag)    Write the Subvolumes array of json output first, each subvolume
+                            as it is produced, followed by the counts
+      -output-format
+                  =string   Output format: json, csv (one row per subvolume), obj (a mesh
+                            of subvolume boxes grouped by fill fraction), dvidroi
+                            (coalesced spans of the active blocks for a DVID ROI) or npy
+                            (int32 NumPy array of the active blocks of each grid cell,
+                            indexed [z, y, x]; with -output, its Shape and MinCell offset
+                            are written to <output>.json, less any .gz) or dvidtiles
+                            (the range of DVID tiles at -scale covering each subvolume)
+      -scale      =number   Scale of dvidtiles output, where a tile is a block of the
+                            scale's 2^scale downsampling (default 0, the blocks themselves)
+      -summary    (flag)    Output only the summary counts without the list of subvolumes
+      -estimate   (flag)    Print the bounding box of the active blocks, their number and the
+                            number of subvolumes to standard error instead of partitioning
+      -overlap-report (flag)
+                            Output CoveredBlocks (counting each covering span), UniqueBlocks
+                            and their OverlapRatio instead of partitioning, to decide on -dedup
+      -count-only (flag)    Output only NumTotalBlocks, NumActiveBlocks and NumSubvolumes,
+                            skipping the SubvolsPruned scan (grid mode and json only)
+      -fail-on-empty (flag) Exit with an error instead of writing output if there are no
+                            subvolumes, e.g. because the input has no spans
+      -named-points (flag)  Output points as {"X": x, "Y": y, "Z": z} instead of [x, y, z]
+      -pretty     (flag)    Indent JSON output (default true); -pretty=false writes compact JSON
+      -indent     =number   Spaces per level of indented JSON output (default 4)
+      -gzip-output (flag)   Gzip the output (default if -output ends in .gz)
+      -verbose    (flag)    Run in verbose mode, logging all diagnostics (-log-level debug)
+      -log-level  =string   Log diagnostics at least this severe: error, warn (skipped or
+                            altered input), info (parameters and final counts) or debug
+                            (progress and timing); overrides -verbose
+      -quiet      (flag)    Write no diagnostics, only errors (the default without -verbose)
+      -version    (flag)    Show version, git commit and build date
   -h, -help       (flag)    Show help message
 
 `
 
+// usage writes the help message to stderr, keeping stdout for output.
 var usage = func() {
-	fmt.Printf(helpMessage)
+	fmt.Fprint(os.Stderr, helpMessage)
 }
 
 func currentDir() string {
@@ -48,170 +377,409 @@ func currentDir() string {
 	return currentDir
 }
 
-// Tuples are (Z, Y, X0, X1)
-type Span [4]int
-
 func main() {
 	flag.BoolVar(showHelp, "h", false, "Show help message")
 	flag.Usage = usage
 	flag.Parse()
 
-	if flag.NArg() >= 1 && strings.ToLower(flag.Args()[0]) == "help" {
-		*showHelp = true
-	}
-
 	if *showHelp {
 		flag.Usage()
 		os.Exit(0)
 	}
+	if *showVersion {
+		runVersion(context.Background(), nil)
+	}
 
-	// Read in from stdin
-	input, err := ioutil.ReadAll(os.Stdin)
-	if err != nil {
-		fmt.Printf("Error in reading from standard input: %s", err.Error())
-		os.Exit(1)
+	// The first argument is a command if it names one.  Otherwise it must be
+	// an input file of the default partition command.
+	name := "partition"
+	args := flag.Args()
+	if len(args) >= 1 {
+		if _, found := commands[strings.ToLower(args[0])]; found {
+			name = strings.ToLower(args[0])
+			args = args[1:]
+		} else if _, err := os.Stat(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", args[0])
+			flag.Usage()
+			os.Exit(2)
+		}
 	}
 
-	// Parse the JSON into spans
-	spans := []Span{}
-	if err := json.Unmarshal(input, &spans); err != nil {
-		fmt.Printf("Error parsing JSON from stdin: %s\n", err.Error())
+	setJSONOptions()
+
+	// Interrupting a run stops it without committing the output file.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	commands[name].run(ctx, args)
+}
+
+// setJSONOptions sets the JSON output toggles from command-line flags, exiting
+// if any are invalid.
+func setJSONOptions() {
+	if *indent < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -indent must be a non-negative number, got %d\n", *indent)
 		os.Exit(1)
 	}
+	NamedPointFields = *namedPoints
+	PrettyJSON = *pretty
+	JSONIndent = *indent
+}
 
-	// Create a simple matrix of 100 x 100 x 100 subvolumes.  If span is within
-	// a subvolume, it gets used.
-	const (
-		nz int = 400
-		ny int = 400
-		nx int = 400
-	)
-	var maxx, maxy, maxz int
-	var numSubvolumes int
-	var numActiveBlocks int
-	var active [nz][ny][nx]int
-	for _, span := range spans {
-		z := span[0]
-		y := span[1]
-		x0 := span[2]
-		x1 := span[3]
-
-		gz := z / *batchsize
-		gy := y / *batchsize
-		if gy >= ny {
-			fmt.Printf("Block y index (%d) exceeds static subvolume.", gy)
-			os.Exit(1)
-		}
-		if gz >= nz {
-			fmt.Printf("Block z index (%d) exceeds static subvolume.", gz)
+// partitionOptions returns the Options set by command-line flags, exiting if
+// any are invalid.
+func partitionOptions() Options {
+	// Validate sizes before reading any input
+	for _, f := range []struct {
+		name   string
+		value  int64
+		zeroOK bool
+	}{
+		{"batchsize", *batchsize, false},
+		{"batchsize-x", *batchsizeX, true},
+		{"batchsize-y", *batchsizeY, true},
+		{"batchsize-z", *batchsizeZ, true},
+		{"blocksize", *blocksize, false},
+		{"blocksize-x", *blocksizeX, true},
+		{"blocksize-y", *blocksizeY, true},
+		{"blocksize-z", *blocksizeZ, true},
+		{"min-active-blocks", *minActiveBlocks, true},
+		{"subvolume-voxels", *subvolumeVoxels, true},
+		{"align", int64(*align), true},
+		{"chunk-align", int64(*chunkAlign), true},
+		{"halo", int64(*halo), true},
+		{"radius", *radius, true},
+		{"merge-max", *mergeMax, !*merge},
+		{"max-active-blocks", *maxActiveBlocks, true},
+		{"grid-size", int64(*gridSize), true},
+		{"scale", int64(*scale), true},
+		{"parallel", int64(*parallel), true},
+	} {
+		if f.value < 0 || (f.value == 0 && !f.zeroOK) {
+			kind := "a positive"
+			if f.zeroOK {
+				kind = "a non-negative"
+			}
+			fmt.Fprintf(os.Stderr, "Error: -%s must be %s number, got %d\n", f.name, kind, f.value)
 			os.Exit(1)
 		}
-		if gz > maxz {
-			maxz = gz
+	}
+
+	// Number of blocks along each (x, y, z) axis of a subvolume.
+	batch := Point3d{*batchsize, *batchsize, *batchsize}
+	for i, size := range []int64{*batchsizeX, *batchsizeY, *batchsizeZ} {
+		if size != 0 {
+			batch[i] = size
 		}
-		if gy > maxy {
-			maxy = gy
+	}
+
+	// Number of voxels along each (x, y, z) axis of a block.
+	block := Point3d{*blocksize, *blocksize, *blocksize}
+	for i, size := range []int64{*blocksizeX, *blocksizeY, *blocksizeZ} {
+		if size != 0 {
+			block[i] = size
 		}
-		for x := x0; x <= x1; x++ {
-			gx := x / *batchsize
-			if gx >= nx {
-				fmt.Printf("Block x index (%d) exceeds static subvolume.", gx)
+	}
+
+	if *noVoxels {
+		flag.Visit(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, "blocksize") || f.Name == "subvolume-voxels" {
+				fmt.Fprintf(os.Stderr, "Error: -no-voxels and -%s cannot both be set\n", f.Name)
 				os.Exit(1)
 			}
-			if gx > maxx {
-				maxx = gx
+		})
+	}
+	if *subvolumeVoxels != 0 {
+		flag.Visit(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, "batchsize") {
+				fmt.Fprintf(os.Stderr, "Error: -subvolume-voxels and -%s cannot both be set\n", f.Name)
+				os.Exit(1)
 			}
-			if active[gz][gy][gx] == 0 {
-				numSubvolumes++
+		})
+		for i, axis := range "xyz" {
+			if *subvolumeVoxels%block[i] != 0 {
+				lower := *subvolumeVoxels - *subvolumeVoxels%block[i]
+				suggestion := fmt.Sprintf("%d", lower+block[i])
+				if lower > 0 {
+					suggestion = fmt.Sprintf("%d or %s", lower, suggestion)
+				}
+				fmt.Fprintf(os.Stderr, "Error: -subvolume-voxels %d is not a multiple of the block size %d along %c; try %s\n",
+					*subvolumeVoxels, block[i], axis, suggestion)
+				os.Exit(1)
 			}
-			active[gz][gy][gx]++
-			numActiveBlocks++
+			batch[i] = *subvolumeVoxels / block[i]
 		}
 	}
 
-	// Print all foreground subvolumes
-	voxelwidth := *batchsize * *blocksize
-	subvolumes := subvolumesT{
-		numSubvolumes * *batchsize * *batchsize * *batchsize,
-		numActiveBlocks,
-		numSubvolumes,
-		0,
-		[]subvolumeT{},
-	}
-	subvolumes.Subvolumes = []subvolumeT{}
-	var numPruned int
-	for z := 0; z < nz; z++ {
-		vz0 := z * voxelwidth
-		vz1 := vz0 + voxelwidth - 1
-		bz0 := vz0 / *blocksize
-		bz1 := vz1 / *blocksize
-		for y := 0; y < ny; y++ {
-			vy0 := y * voxelwidth
-			vy1 := vy0 + voxelwidth - 1
-			by0 := vy0 / *blocksize
-			by1 := vy1 / *blocksize
-			for x := 0; x < nx; x++ {
-				vx0 := x * voxelwidth
-				vx1 := vx0 + voxelwidth - 1
-				bx0 := vx0 / *blocksize
-				bx1 := vx1 / *blocksize
-				if active[z][y][x] > 0 {
-					voxelExtent := Extents3d{
-						Point3d{vx0, vy0, vz0},
-						Point3d{vx1, vy1, vz1},
-					}
-					blockExtent := ChunkExtents3d{
-						Point3d{bx0, by0, bz0},
-						Point3d{bx1, by1, bz1},
-					}
-					subvol := subvolumeT{
-						voxelExtent,
-						blockExtent,
-						*batchsize * *batchsize * *batchsize,
-						active[z][y][x],
-					}
-					subvolumes.Subvolumes = append(subvolumes.Subvolumes, subvol)
-				} else if z <= maxz && y <= maxy && x <= maxx {
-					numPruned++
-				}
-			}
+	if *swapReversed && *rejectReversed {
+		fmt.Fprintf(os.Stderr, "Error: -swap-reversed and -reject-reversed cannot both be set\n")
+		os.Exit(1)
+	}
+	reversed := SkipReversed
+	if *swapReversed {
+		reversed = SwapReversed
+	} else if *rejectReversed {
+		reversed = RejectReversed
+	}
+
+	var clip *ChunkExtents3d
+	if *bbox != "" {
+		extents, err := parseBBox(*bbox)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -bbox %s\n", err.Error())
+			os.Exit(1)
+		}
+		clip = &extents
+	}
+
+	var voxelSize *[3]float64
+	if *resolution != "" {
+		res, err := parseResolution(*resolution)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -resolution %s\n", err.Error())
+			os.Exit(1)
+		}
+		voxelSize = &res
+	}
+
+	if *mergeMax != 0 && !*merge {
+		fmt.Fprintf(os.Stderr, "Error: -merge-max requires -merge\n")
+		os.Exit(1)
+	}
+
+	opts := Options{
+		BatchSize:        batch,
+		BlockSize:        block,
+		NoVoxels:         *noVoxels,
+		Origin:           Point3d{*originX, *originY, *originZ},
+		BBox:             clip,
+		Resolution:       voxelSize,
+		Align:            *align,
+		ChunkAlign:       *chunkAlign,
+		InputFormat:      *inputFormat,
+		Radius:           *radius,
+		JSONPointer:      *jsonPointer,
+		EmbeddedEncoding: *embeddedEncoding,
+		OutputFormat:     *outputFormat,
+		Scale:            *scale,
+		Summary:          *summaryOnly,
+		CountOnly:        *countOnly,
+		FailOnEmpty:      *failOnEmpty,
+		MinActiveBlocks:  *minActiveBlocks,
+		Halo:             *halo,
+		TargetSubvolumes: *targetSubvolumes,
+		Mode:             *mode,
+		LeafMax:          *leafMax,
+		Partitions:       *partitions,
+		MergeMax:         *mergeMax,
+		MaxActiveBlocks:  *maxActiveBlocks,
+		Adjacency:        *adjacency,
+		Components:       *components,
+		Order:            *order,
+		Units:            *units,
+		HalfOpen:         *halfOpen,
+		Boundary:         *boundary,
+		AssertCover:      *assertCover,
+		SubvolumeSpans:   *coalesceOutput,
+		SplitDir:         *splitDir,
+		Stream:           *stream,
+		GridSize:         *gridSize,
+		Dedup:            *dedup,
+		VoxelCoords:      *voxelCoords,
+		Reversed:         reversed,
+		ExclusiveX:       *exclusiveX,
+		RunAxis:          *runAxis,
+		Labeled:          *labeled,
+		Weighted:         *weighted,
+		SkipBad:          *skipBad,
+		Parallel:         *parallel,
+	}
+	if *quiet && (*runVerbose || *logLevel != "") {
+		fmt.Fprintf(os.Stderr, "Error: -quiet cannot be combined with -verbose or -log-level\n")
+		os.Exit(1)
+	}
+	if *logLevel != "" {
+		level, err := parseLogLevel(*logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -log-level %s\n", err.Error())
+			os.Exit(1)
 		}
+		opts.LogLevel = level
+		opts.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else if *runVerbose {
+		opts.Logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
-	subvolumes.SubvolsPruned = numPruned
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *excludePath != "" {
+		opts.Exclude = readExclude(*excludePath, opts)
+	}
+	return opts
+}
 
-	// Encode as JSON
-	jsonBytes, err := json.MarshalIndent(subvolumes, "", "    ")
+// readExclude returns the spans in the exclusion file at path, exiting if it
+// cannot be read.
+func readExclude(path string, opts Options) []Span {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Printf("Error turning partitioning into JSON: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "Error opening exclusion file %q: %s\n", path, err.Error())
+		os.Exit(1)
 	}
-	fmt.Println(string(jsonBytes))
+	defer f.Close()
+	spans, err := ReadSpans(context.Background(), f, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading exclusion file %q: %s\n", path, err.Error())
+		os.Exit(1)
+	}
+	return spans
 }
 
-type Point3d [3]int
+// parseResolution parses an "x,y,z" voxel resolution.
+func parseResolution(s string) ([3]float64, error) {
+	var res [3]float64
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return res, fmt.Errorf("must be 3 comma-separated positive numbers x,y,z, got %q", s)
+	}
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || !(v > 0) || math.IsInf(v, 0) {
+			return res, fmt.Errorf("must be 3 comma-separated positive numbers x,y,z, got %q", s)
+		}
+		res[i] = v
+	}
+	return res, nil
+}
 
-type subvolumesT struct {
-	NumTotalBlocks  int
-	NumActiveBlocks int
-	NumSubvolumes   int
-	SubvolsPruned   int
-	Subvolumes      []subvolumeT
+// parseBBox parses a "z0,y0,x0,z1,y1,x1" bounding box of blocks.
+func parseBBox(s string) (ChunkExtents3d, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 6 {
+		return ChunkExtents3d{}, fmt.Errorf("must be 6 comma-separated integers z0,y0,x0,z1,y1,x1, got %q", s)
+	}
+	var coords [6]int64
+	for i, field := range fields {
+		n, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return ChunkExtents3d{}, fmt.Errorf("must be 6 comma-separated integers z0,y0,x0,z1,y1,x1, got %q", s)
+		}
+		coords[i] = n
+	}
+	extents := ChunkExtents3d{
+		MinChunk: Point3d{coords[2], coords[1], coords[0]},
+		MaxChunk: Point3d{coords[5], coords[4], coords[3]},
+	}
+	for i, axis := range "xyz" {
+		if extents.MinChunk[i] > extents.MaxChunk[i] {
+			return ChunkExtents3d{}, fmt.Errorf("minimum %c %d is greater than maximum %d", axis, extents.MinChunk[i], extents.MaxChunk[i])
+		}
+	}
+	return extents, nil
 }
 
-type subvolumeT struct {
-	Extents3d
-	ChunkExtents3d
-	TotalBlocks  int
-	ActiveBlocks int
+// process calls run with the input files at paths, or stdin if there are none,
+// and the output file or stdout, gzipping the output if requested.  The output
+// file is only created if run succeeds.
+func process(paths []string, run func(sources []Source, w io.Writer) error) {
+	// Read in from the input files or stdin
+	var sources []Source
+	source := "standard input"
+	if len(paths) == 0 {
+		sources = []Source{{Reader: os.Stdin}}
+	}
+	for _, path := range paths {
+		input, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input file %q: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+		defer input.Close()
+		sources = append(sources, Source{Name: fmt.Sprintf("input file %q", path), Reader: input})
+	}
+	if len(paths) == 1 {
+		// The single file is named in the final error message instead.
+		source = sources[0].Name
+		sources[0].Name = ""
+	} else if len(paths) > 1 {
+		source = fmt.Sprintf("%d input files", len(paths))
+	}
+
+	// Write to the output file or stdout
+	var output io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		var err error
+		outputFile, err = createOutput(*outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file %q: %s\n", *outputPath, err.Error())
+			os.Exit(1)
+		}
+		output = outputFile
+	}
+
+	var zw *gzip.Writer
+	if *gzipOutput || strings.HasSuffix(*outputPath, ".gz") {
+		zw = gzip.NewWriter(output)
+		output = zw
+	}
+
+	err := run(sources, output)
+	if err == nil && zw != nil {
+		// Flush any buffered data and write the gzip footer.
+		err = zw.Close()
+	}
+	if err != nil {
+		if outputFile != nil {
+			outputFile.Abort()
+		}
+		fmt.Fprintf(os.Stderr, "Error processing %s: %s\n", source, err.Error())
+		os.Exit(1)
+	}
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output file %q: %s\n", *outputPath, err.Error())
+			os.Exit(1)
+		}
+	}
 }
 
-// Extents defines a 3d volume
-type Extents3d struct {
-	MinPoint Point3d
-	MaxPoint Point3d
+// atomicFile is written to a temporary file in the same directory as its
+// destination and renamed into place on Commit, so a failed write never
+// leaves a truncated file.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createOutput(path string) (*atomicFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{f, path}, nil
+}
+
+// Commit closes the temporary file and renames it to the destination.
+func (f *atomicFile) Commit() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
 }
 
-// ChunkExtents3d defines a 3d volume of chunks
-type ChunkExtents3d struct {
-	MinChunk Point3d
-	MaxChunk Point3d
+// Abort closes and removes the temporary file.
+func (f *atomicFile) Abort() {
+	f.File.Close()
+	os.Remove(f.Name())
 }
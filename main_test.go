@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the CLI instead of the tests when runCLI sets
+// PARTITION_TEST_MAIN, so tests can check its output and exit status.
+func TestMain(m *testing.M) {
+	if os.Getenv("PARTITION_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the CLI with args and stdin in a subprocess, returning its
+// standard output, standard error and exit status.
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PARTITION_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("error running CLI with %v: %s", args, err.Error())
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+func TestZeroSizes(t *testing.T) {
+	for _, name := range []string{"batchsize", "blocksize"} {
+		// Standard input is never read, so an invalid input cannot fail first.
+		stdout, stderr, status := runCLI(t, "not json", "-"+name, "0")
+		if status == 0 {
+			t.Errorf("-%s 0: exit status 0, want non-zero", name)
+		}
+		want := "Error: -" + name + " must be a positive number, got 0"
+		if !strings.Contains(stderr, want) {
+			t.Errorf("-%s 0: got error %q, want %q", name, stderr, want)
+		}
+		if stdout != "" {
+			t.Errorf("-%s 0: got output %q, want none", name, stdout)
+		}
+	}
+}
+
+func TestSubvolumeVoxels(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-subvolume-voxels", "500"}, "Error: -subvolume-voxels 500 is not a multiple of the block size 32 along x; try 480 or 512"},
+		{[]string{"-subvolume-voxels", "20"}, "Error: -subvolume-voxels 20 is not a multiple of the block size 32 along x; try 32"},
+		{[]string{"-subvolume-voxels", "512", "-blocksize-z", "48"}, "Error: -subvolume-voxels 512 is not a multiple of the block size 48 along z; try 480 or 528"},
+		{[]string{"-subvolume-voxels", "512", "-batchsize", "16"}, "Error: -subvolume-voxels and -batchsize cannot both be set"},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runCLI(t, "not json", test.args...)
+		if status == 0 {
+			t.Errorf("%v: exit status 0, want non-zero", test.args)
+		}
+		if !strings.Contains(stderr, test.err) {
+			t.Errorf("%v: got error %q, want %q", test.args, stderr, test.err)
+		}
+		if stdout != "" {
+			t.Errorf("%v: got output %q, want none", test.args, stdout)
+		}
+	}
+
+	// A size that divides evenly is the same as the batch size it implies.
+	want, _, status := runCLI(t, testSpansJSON, "-batchsize", "16")
+	if status != 0 {
+		t.Fatalf("-batchsize 16: exit status %d", status)
+	}
+	if got, stderr, _ := runCLI(t, testSpansJSON, "-subvolume-voxels", "512"); got != want {
+		t.Errorf("-subvolume-voxels 512: got\n%s%s\nwant\n%s", got, stderr, want)
+	}
+}
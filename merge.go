@@ -0,0 +1,57 @@
+package main
+
+import "sort"
+
+// mergeSubvolumes merges runs of adjacent subvolumes along x, then y, then z
+// while their combined active blocks are at most maxActive.  Only subvolumes
+// with identical extents along the other two axes are merged, so each merged
+// subvolume is exactly the union of its parts.  Halos must not have been added.
+func mergeSubvolumes(subvols []subvolumeT, maxActive int64, block Point3d) []subvolumeT {
+	for axis := 0; axis < 3; axis++ {
+		subvols = mergeAlong(subvols, axis, maxActive, block)
+	}
+	return subvols
+}
+
+// mergeAlong merges runs of subvolumes adjacent along axis.
+func mergeAlong(subvols []subvolumeT, axis int, maxActive int64, block Point3d) []subvolumeT {
+	u, v := (axis+1)%3, (axis+2)%3
+
+	// Sort so subvolumes with the same cross-section are consecutive and
+	// ordered along axis.
+	sort.SliceStable(subvols, func(i, j int) bool {
+		a, b := subvols[i].ChunkExtents3d, subvols[j].ChunkExtents3d
+		for _, dim := range []int{u, v} {
+			if a.MinChunk[dim] != b.MinChunk[dim] {
+				return a.MinChunk[dim] < b.MinChunk[dim]
+			}
+			if a.MaxChunk[dim] != b.MaxChunk[dim] {
+				return a.MaxChunk[dim] < b.MaxChunk[dim]
+			}
+		}
+		return a.MinChunk[axis] < b.MinChunk[axis]
+	})
+
+	merged := subvols[:0]
+	for _, subvol := range subvols {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.MinChunk[u] == subvol.MinChunk[u] && last.MaxChunk[u] == subvol.MaxChunk[u] &&
+				last.MinChunk[v] == subvol.MinChunk[v] && last.MaxChunk[v] == subvol.MaxChunk[v] &&
+				last.MaxChunk[axis]+1 == subvol.MinChunk[axis] &&
+				last.ActiveBlocks+subvol.ActiveBlocks <= maxActive {
+				chunks := last.ChunkExtents3d
+				chunks.MaxChunk[axis] = subvol.MaxChunk[axis]
+				weight := last.TotalWeight
+				if weight != nil {
+					*weight += *subvol.TotalWeight
+				}
+				*last = newSubvolume(chunks, last.ActiveBlocks+subvol.ActiveBlocks, block)
+				last.TotalWeight = weight
+				continue
+			}
+		}
+		merged = append(merged, subvol)
+	}
+	return merged
+}
@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+// Partitioning modes: "grid" (the default) splits the blocks into a uniform
+// grid of BatchSize subvolumes, "octree" recursively splits the bounding box
+// of the active blocks until each leaf holds at most LeafMax of them, and
+// "rcb" recursively bisects the active blocks into Partitions pieces of about
+// equal size.
+const (
+	gridMode   = "grid"
+	octreeMode = "octree"
+	rcbMode    = "rcb"
+)
+
+func (opts Options) mode() string {
+	if opts.Mode == "" {
+		return gridMode
+	}
+	return opts.Mode
+}
+
+func validateMode(opts Options) error {
+	switch opts.mode() {
+	case gridMode:
+		return nil
+	case octreeMode:
+		if opts.LeafMax <= 0 {
+			return fmt.Errorf("octree mode requires a positive leaf maximum, got %d", opts.LeafMax)
+		}
+		return nil
+	case rcbMode:
+		if opts.Partitions <= 0 {
+			return fmt.Errorf("rcb mode requires a positive number of partitions, got %d", opts.Partitions)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown partitioning mode %q", opts.Mode)
+}
+
+// leafSubvolumes returns the subvolumes covering the spans retained by finish
+// in octree or rcb mode, pruning those with fewer than MinActiveBlocks active
+// blocks, along with the number of empty branches and subvolumes pruned.
+func (acc *accumulator) leafSubvolumes() ([]subvolumeT, int64) {
+	if acc.numActiveBlocks == 0 {
+		return []subvolumeT{}, 0
+	}
+	var leaves []subvolumeT
+	var pruned int64
+	switch acc.opts.mode() {
+	case octreeMode:
+		leaves, pruned = octreeLeaves(acc.spans, acc.activeChunks, acc.opts.LeafMax, acc.opts.BlockSize)
+	case rcbMode:
+		leaves = rcbLeaves(acc.spans, acc.opts.Partitions, acc.opts.BlockSize)
+	}
+	subvols := make([]subvolumeT, 0, len(leaves))
+	for _, leaf := range leaves {
+		if leaf.ActiveBlocks >= acc.opts.MinActiveBlocks {
+			subvols = append(subvols, leaf)
+		}
+	}
+	return subvols, pruned + int64(len(leaves)-len(subvols))
+}
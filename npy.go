@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// npyGrid is the dense array of active block counts of the grid cells within
+// the bounding box of the subvolumes, written by encodeNPY.
+type npyGrid struct {
+	// Number of cells along (z, y, x), the npy shape of the array.
+	Shape [3]int64
+
+	// Grid index (x, y, z) of the cell at array index [0, 0, 0], and the
+	// block at its lower corner.
+	MinCell  Point3d
+	MinChunk Point3d
+
+	BatchSize Point3d
+
+	counts []int32
+}
+
+// newNPYGrid returns the grid of the subvolumes, which must each be a single
+// grid cell.
+func newNPYGrid(subvolumes subvolumesT) (npyGrid, error) {
+	params := subvolumes.Params
+	grid := npyGrid{BatchSize: params.BatchSize}
+	var maxCell Point3d
+	for i, subvol := range subvolumes.Subvolumes {
+		if subvol.cell == nil {
+			return grid, fmt.Errorf("npy output requires subvolumes that are grid cells")
+		}
+		for axis, index := range subvol.cell {
+			if i == 0 || index < grid.MinCell[axis] {
+				grid.MinCell[axis] = index
+			}
+			if i == 0 || index > maxCell[axis] {
+				maxCell[axis] = index
+			}
+		}
+	}
+	if len(subvolumes.Subvolumes) == 0 {
+		return grid, nil
+	}
+	// The array must be addressable, which limits it to 2 GB of data on 32-bit
+	// platforms.
+	for axis := range grid.MinCell {
+		grid.Shape[2-axis] = maxCell[axis] - grid.MinCell[axis] + 1
+		grid.MinChunk[axis] = params.Origin[axis] + grid.MinCell[axis]*params.BatchSize[axis]
+	}
+	cells := int64(1)
+	for _, size := range grid.Shape {
+		if cells > math.MaxInt/4/size {
+			return grid, fmt.Errorf("npy array of %d x %d x %d cells is too large", grid.Shape[0], grid.Shape[1], grid.Shape[2])
+		}
+		cells *= size
+	}
+
+	grid.counts = make([]int32, cells)
+	for _, subvol := range subvolumes.Subvolumes {
+		if subvol.ActiveBlocks > math.MaxInt32 {
+			return grid, fmt.Errorf("subvolume %s has %d active blocks, too many for npy int32 output", subvol.Key, subvol.ActiveBlocks)
+		}
+		cell := *subvol.cell
+		z := cell[2] - grid.MinCell[2]
+		y := cell[1] - grid.MinCell[1]
+		x := cell[0] - grid.MinCell[0]
+		grid.counts[(z*grid.Shape[1]+y)*grid.Shape[2]+x] = int32(subvol.ActiveBlocks)
+	}
+	return grid, nil
+}
+
+// encodeNPY writes the active block counts of the grid cells as a little-endian
+// int32 NumPy array of shape (z, y, x), so cell (x, y, z) of the grid is at
+// index [z, y, x] offset by MinCell.  The offset is not part of the format;
+// Options.NPYInfo receives it.
+func encodeNPY(w io.Writer, subvolumes subvolumesT) error {
+	grid, err := newNPYGrid(subvolumes)
+	if err != nil {
+		return err
+	}
+	return grid.write(w)
+}
+
+// npyChunkCells is the number of cells write encodes at a time.
+const npyChunkCells = 1 << 16
+
+// write writes the grid as an npy array, encoding a chunk of cells at a time
+// so the array is not held twice.
+func (grid npyGrid) write(w io.Writer) error {
+	if _, err := w.Write(npyHeader(grid.Shape)); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	data := make([]byte, 4*min(len(grid.counts), npyChunkCells))
+	for start := 0; start < len(grid.counts); start += npyChunkCells {
+		chunk := grid.counts[start:min(start+npyChunkCells, len(grid.counts))]
+		for i, count := range chunk {
+			binary.LittleEndian.PutUint32(data[4*i:], uint32(count))
+		}
+		if _, err := w.Write(data[:4*len(chunk)]); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// npyHeader returns the version 1.0 npy header of a C-order int32 array of the
+// given shape, padded so the data starts on a 64-byte boundary.
+func npyHeader(shape [3]int64) []byte {
+	dict := fmt.Sprintf("{'descr': '<i4', 'fortran_order': False, 'shape': (%d, %d, %d), }", shape[0], shape[1], shape[2])
+	const prefixLen = 10 // magic, version and header length
+	padded := (prefixLen + len(dict) + 1 + 63) / 64 * 64
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(padded-prefixLen))
+	buf.WriteString(dict)
+	buf.Write(bytes.Repeat([]byte{' '}, padded-prefixLen-len(dict)-1))
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNPYTooLarge(t *testing.T) {
+	// Grid cells 2^21 apart along each axis need an array of 2^63 cells.
+	far := int64(1) << 25
+	subvolumes := partition(t, []Span{{0, 0, 0, 0}, {far, far, far, far}}, testOptions())
+	_, err := newNPYGrid(subvolumes)
+	if want := "is too large"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+
+	// Nearby cells fit.
+	subvolumes = partition(t, []Span{{0, 0, 0, 0}, {16, 32, 48, 48}}, testOptions())
+	grid, err := newNPYGrid(subvolumes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [3]int64{2, 3, 4}; grid.Shape != want {
+		t.Errorf("got shape %v, want %v", grid.Shape, want)
+	}
+}
+
+func TestNPYInfo(t *testing.T) {
+	// More cells than are encoded at once.
+	input := `[[0,0,0,1],[640,656,800,800]]`
+	opts := testOptions()
+	opts.OutputFormat = "npy"
+	want := run(t, input, opts)
+
+	// The array is the same with the info, which has the grid's offset.
+	var info bytes.Buffer
+	opts.NPYInfo = &info
+	if got := run(t, input, opts); got != want {
+		t.Errorf("got %d bytes of npy output with info, want the %d without", len(got), len(want))
+	}
+	var grid npyGrid
+	if err := json.Unmarshal(info.Bytes(), &grid); err != nil {
+		t.Fatal(err)
+	}
+	if shape := [3]int64{41, 42, 51}; grid.Shape != shape || grid.MinCell != (Point3d{}) {
+		t.Errorf("got info %s, want shape %v at cell 0", info.String(), shape)
+	}
+	data := []byte(want)
+	data = data[len(npyHeader(grid.Shape)):]
+	if len(data) != 4*41*42*51 {
+		t.Fatalf("got %d bytes of data, want %d", len(data), 4*41*42*51)
+	}
+	counts := map[int]uint32{}
+	for i := 0; i < len(data); i += 4 {
+		if count := binary.LittleEndian.Uint32(data[i:]); count != 0 {
+			counts[i/4] = count
+		}
+	}
+	last := 41*42*51 - 1
+	if len(counts) != 2 || counts[0] != 2 || counts[last] != 1 {
+		t.Errorf("got counts %v, want 2 at 0 and 1 at %d", counts, last)
+	}
+}
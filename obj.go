@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// cubeFaces lists the corners of each face of a cube, numbered by bits x = 1,
+// y = 2 and z = 4 and ordered counterclockwise seen from outside.
+var cubeFaces = [6][4]int{
+	{0, 2, 3, 1}, // -z
+	{4, 5, 7, 6}, // +z
+	{0, 1, 5, 4}, // -y
+	{2, 6, 7, 3}, // +y
+	{0, 4, 6, 2}, // -x
+	{1, 3, 7, 5}, // +x
+}
+
+// encodeOBJ writes the voxel extents of each subvolume as a cube in Wavefront
+// OBJ format, for viewing the partition in a 3D viewer.  Cubes are grouped by
+// tenths of fill fraction, e.g. "fill_0.3-0.4".
+func encodeOBJ(w io.Writer, subvolumes subvolumesT) error {
+	var groups [fillBuckets][]subvolumeT
+	for _, subvol := range subvolumes.Subvolumes {
+		bucket := int(subvol.FillFraction * fillBuckets)
+		if bucket >= fillBuckets {
+			bucket = fillBuckets - 1
+		}
+		groups[bucket] = append(groups[bucket], subvol)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %d subvolumes with %d active blocks\n", subvolumes.NumSubvolumes, subvolumes.NumActiveBlocks)
+	vertex := 1
+	for bucket, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "g fill_%.1f-%.1f\n", float64(bucket)/fillBuckets, float64(bucket+1)/fillBuckets)
+		for _, subvol := range group {
+			fmt.Fprintf(bw, "# subvolume %d\n", subvol.ID)
+			lo, hi := subvol.MinPoint, subvol.MaxPoint
+			for corner := 0; corner < 8; corner++ {
+				var pt Point3d
+				for i := range pt {
+					pt[i] = lo[i]
+					if corner&(1<<uint(i)) != 0 {
+						pt[i] = hi[i] + 1
+					}
+				}
+				fmt.Fprintf(bw, "v %d %d %d\n", pt[0], pt[1], pt[2])
+			}
+			for _, face := range cubeFaces {
+				fmt.Fprintf(bw, "f %d %d %d %d\n", vertex+face[0], vertex+face[1], vertex+face[2], vertex+face[3])
+			}
+			vertex += 8
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+// octreeLeaves recursively splits box in half along each axis longer than one
+// block, stopping a branch once it covers at most leafMax active blocks.  spans
+// must not overlap and must lie within box.  The non-empty leaves are returned
+// along with the number of empty branches pruned.
+func octreeLeaves(spans []Span, box ChunkExtents3d, leafMax int64, block Point3d) ([]subvolumeT, int64) {
+	var leaves []subvolumeT
+	var pruned int64
+	var split func(spans []Span, box ChunkExtents3d)
+	split = func(spans []Span, box ChunkExtents3d) {
+		var active int64
+		for _, span := range spans {
+			active += span[3] - span[2] + 1
+		}
+		if active == 0 {
+			pruned++
+			return
+		}
+		if active <= leafMax || box.numBlocks() == 1 {
+			leaves = append(leaves, newSubvolume(box, active, block))
+			return
+		}
+
+		// Halves of box along each (x, y, z) axis, with a single half along axes
+		// only one block long.
+		var halves [3][]ChunkExtents3d
+		for i := range halves {
+			lo, hi := box, box
+			if box.MinChunk[i] == box.MaxChunk[i] {
+				halves[i] = []ChunkExtents3d{lo}
+				continue
+			}
+			mid := box.MinChunk[i] + (box.MaxChunk[i]-box.MinChunk[i]+1)/2
+			lo.MaxChunk[i] = mid - 1
+			hi.MinChunk[i] = mid
+			halves[i] = []ChunkExtents3d{lo, hi}
+		}
+		for _, z := range halves[2] {
+			for _, y := range halves[1] {
+				for _, x := range halves[0] {
+					child := ChunkExtents3d{
+						Point3d{x.MinChunk[0], y.MinChunk[1], z.MinChunk[2]},
+						Point3d{x.MaxChunk[0], y.MaxChunk[1], z.MaxChunk[2]},
+					}
+					split(clipSpans(spans, child), child)
+				}
+			}
+		}
+	}
+	split(spans, box)
+	return leaves, pruned
+}
+
+// clipSpans returns the parts of spans within box.
+func clipSpans(spans []Span, box ChunkExtents3d) []Span {
+	var clipped []Span
+	for _, span := range spans {
+		if span[0] < box.MinChunk[2] || span[0] > box.MaxChunk[2] ||
+			span[1] < box.MinChunk[1] || span[1] > box.MaxChunk[1] {
+			continue
+		}
+		if span[2] < box.MinChunk[0] {
+			span[2] = box.MinChunk[0]
+		}
+		if span[3] > box.MaxChunk[0] {
+			span[3] = box.MaxChunk[0]
+		}
+		if span[2] <= span[3] {
+			clipped = append(clipped, span)
+		}
+	}
+	return clipped
+}
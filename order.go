@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// subvolumeOrders maps each output order to a function that sorts subvolumes
+// in that order.  Sorting is stable, so the order is deterministic for a given
+// input.
+var subvolumeOrders = map[string]func([]subvolumeT){
+	"scan":        sortScan,
+	"morton":      sortMorton,
+	"active-desc": sortActiveDesc,
+}
+
+func (opts Options) order() string {
+	if opts.Order == "" {
+		return "scan"
+	}
+	return opts.Order
+}
+
+func validateOrder(order string) error {
+	if _, found := subvolumeOrders[order]; !found {
+		return fmt.Errorf("unknown subvolume order %q", order)
+	}
+	return nil
+}
+
+// sortScan sorts subvolumes by the z, then y, then x of their MinChunk.
+func sortScan(subvols []subvolumeT) {
+	sort.SliceStable(subvols, func(i, j int) bool {
+		a, b := subvols[i].MinChunk, subvols[j].MinChunk
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+}
+
+// sortActiveDesc sorts subvolumes by decreasing ActiveBlocks, so the largest
+// jobs come first, breaking ties in scan order.
+func sortActiveDesc(subvols []subvolumeT) {
+	sortScan(subvols)
+	sort.SliceStable(subvols, func(i, j int) bool {
+		return subvols[i].ActiveBlocks > subvols[j].ActiveBlocks
+	})
+}
+
+// sortMorton sorts subvolumes by the Morton (Z-order) code of their MinChunk,
+// relative to the smallest MinChunk so coordinates are non-negative.
+func sortMorton(subvols []subvolumeT) {
+	if len(subvols) == 0 {
+		return
+	}
+	offset := subvols[0].MinChunk
+	for _, subvol := range subvols[1:] {
+		for i, v := range subvol.MinChunk {
+			if v < offset[i] {
+				offset[i] = v
+			}
+		}
+	}
+	sort.SliceStable(subvols, func(i, j int) bool {
+		return mortonLess(subvols[i].MinChunk, subvols[j].MinChunk, offset)
+	})
+}
+
+// mortonLess returns true if the Morton code of a - offset is less than that
+// of b - offset, without computing the interleaved codes.  The axis with the
+// most significant differing bit decides, with z above y above x.
+func mortonLess(a, b, offset Point3d) bool {
+	axis := -1
+	var msb uint64
+	for i := 2; i >= 0; i-- {
+		diff := uint64(a[i]-offset[i]) ^ uint64(b[i]-offset[i])
+		if axis < 0 || (msb < diff && msb < (msb^diff)) {
+			axis = i
+			msb = diff
+		}
+	}
+	return uint64(a[axis]-offset[axis]) < uint64(b[axis]-offset[axis])
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	// Subvolumes with 2, 2, 3, 1 and 2 active blocks.
+	spans := []Span{{0, 0, 0, 1}, {0, 0, 16, 17}, {0, 16, 0, 2}, {16, 0, 0, 0}, {16, 16, 32, 33}}
+	tests := []struct {
+		order string
+		keys  []string
+	}{
+		{"scan", []string{"0_0_0", "16_0_0", "0_16_0", "0_0_16", "32_16_16"}},
+		{"morton", []string{"0_0_0", "16_0_0", "0_16_0", "0_0_16", "32_16_16"}},
+		// Subvolumes with the same active blocks stay in scan order.
+		{"active-desc", []string{"0_16_0", "0_0_0", "16_0_0", "32_16_16", "0_0_16"}},
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		for _, parallel := range []int{1, 4} {
+			// The order does not depend on the order of the spans.
+			for trial := 0; trial < 5; trial++ {
+				shuffled := append([]Span{}, spans...)
+				r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				opts := testOptions()
+				opts.Order = test.order
+				opts.Parallel = parallel
+				var keys []string
+				for i, subvol := range partition(t, shuffled, opts).Subvolumes {
+					if subvol.ID != i {
+						t.Errorf("%s: subvolume %d has ID %d", test.order, i, subvol.ID)
+					}
+					keys = append(keys, subvol.Key)
+				}
+				if !reflect.DeepEqual(keys, test.keys) {
+					t.Errorf("%s order of %v with %d workers: got %v, want %v", test.order, shuffled, parallel, keys, test.keys)
+				}
+			}
+		}
+	}
+
+	if err := validateOrder("random"); err == nil {
+		t.Errorf("unknown order: got no error")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// subvolumeEncoders maps each output format to a function that writes a
+// partitioning to a writer.
+var subvolumeEncoders = map[string]func(io.Writer, subvolumesT) error{
+	"json":      encodeJSON,
+	"csv":       encodeCSV,
+	"obj":       encodeOBJ,
+	"npy":       encodeNPY,
+	"dvidtiles": encodeDVIDTiles,
+}
+
+// spanEncoders maps each output format that writes the active blocks, rather
+// than the subvolumes, to a function writing their coalesced spans.
+var spanEncoders = map[string]func(io.Writer, []Span) error{
+	"dvidroi": encodeSpans,
+}
+
+// encodeJSON writes subvolumes as indented JSON.
+func encodeJSON(w io.Writer, subvolumes subvolumesT) error {
+	return writeJSON(w, subvolumes)
+}
+
+// PrettyJSON selects indented rather than compact JSON output.
+var PrettyJSON = true
+
+// JSONIndent is the number of spaces each level of indented JSON output is
+// indented by.
+var JSONIndent = 4
+
+// writeJSON writes v as JSON, indented if PrettyJSON is set.
+func writeJSON(w io.Writer, v interface{}) error {
+	var jsonBytes []byte
+	var err error
+	if PrettyJSON {
+		jsonBytes, err = json.MarshalIndent(v, "", strings.Repeat(" ", JSONIndent))
+	} else {
+		jsonBytes, err = json.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Errorf("error turning partitioning into JSON: %s", err.Error())
+	}
+	jsonBytes = append(jsonBytes, '\n')
+	if _, err := w.Write(jsonBytes); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	return nil
+}
+
+// Columns of the extents written by encodeCSV, between the ID and Key and
+// the counts.
+var (
+	csvPointColumns = []string{
+		"MinPointX", "MinPointY", "MinPointZ",
+		"MaxPointX", "MaxPointY", "MaxPointZ",
+	}
+	csvChunkColumns = []string{
+		"MinChunkX", "MinChunkY", "MinChunkZ",
+		"MaxChunkX", "MaxChunkY", "MaxChunkZ",
+	}
+)
+
+// csvPoint formats pt as "x,y,z" for the summary lines of encodeCSV.
+func csvPoint(pt Point3d) string {
+	return fmt.Sprintf("%d,%d,%d", pt[0], pt[1], pt[2])
+}
+
+// encodeCSV writes the summary counts as "#" comment lines followed by a header
+// row and one row per subvolume.
+func encodeCSV(w io.Writer, subvolumes subvolumesT) error {
+	_, err := fmt.Fprintf(w, "# NumTotalBlocks: %d\n# NumActiveBlocks: %d\n", subvolumes.NumTotalBlocks, subvolumes.NumActiveBlocks)
+	if err == nil && subvolumes.NumActiveVoxels != nil {
+		_, err = fmt.Fprintf(w, "# NumActiveVoxels: %d\n", *subvolumes.NumActiveVoxels)
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(w, "# NumSubvolumes: %d\n# SubvolsPruned: %d\n", subvolumes.NumSubvolumes, subvolumes.SubvolsPruned)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	if subvolumes.DuplicateBlocks != nil {
+		if _, err := fmt.Fprintf(w, "# DuplicateBlocks: %d\n", *subvolumes.DuplicateBlocks); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+	}
+	params := subvolumes.Params
+	_, err = fmt.Fprintf(w, "# BatchSize: %s\n", csvPoint(params.BatchSize))
+	if err == nil && params.BlockSize != nil {
+		_, err = fmt.Fprintf(w, "# BlockSize: %s\n", csvPoint(*params.BlockSize))
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(w, "# Origin: %s\n# Mode: %s\n", csvPoint(params.Origin), params.Mode)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	if res := subvolumes.Resolution; res != nil {
+		if _, err := fmt.Fprintf(w, "# Resolution: %g,%g,%g\n", res[0], res[1], res[2]); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+	}
+	cw := csv.NewWriter(w)
+	extentColumns, _ := csvExtents(subvolumeT{}, subvolumes.units)
+	header := append([]string{"ID", "Key"}, extentColumns...)
+	header = append(header, "TotalBlocks", "ActiveBlocks", "FillFraction")
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	record := make([]string, 0, len(header))
+	for _, subvol := range subvolumes.Subvolumes {
+		record = append(record[:0], strconv.Itoa(subvol.ID), subvol.Key)
+		_, extents := csvExtents(subvol, subvolumes.units)
+		for _, pt := range extents {
+			for _, v := range pt {
+				record = append(record, strconv.FormatInt(v, 10))
+			}
+		}
+		record = append(record,
+			strconv.FormatInt(subvol.TotalBlocks, 10),
+			strconv.FormatInt(subvol.ActiveBlocks, 10),
+			strconv.FormatFloat(subvol.FillFraction, 'g', -1, 64))
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	return nil
+}
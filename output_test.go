@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// setJSON sets PrettyJSON and JSONIndent until the end of the test.
+func setJSON(t *testing.T, pretty bool, indent int) {
+	oldPretty, oldIndent := PrettyJSON, JSONIndent
+	t.Cleanup(func() { PrettyJSON, JSONIndent = oldPretty, oldIndent })
+	PrettyJSON, JSONIndent = pretty, indent
+}
+
+// encode returns subvolumes encoded as JSON.
+func encode(t *testing.T, subvolumes subvolumesT) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, subvolumes); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCompactJSON(t *testing.T) {
+	subvolumes := partition(t, adjacencySpans, testOptions())
+	pretty := encode(t, subvolumes)
+	setJSON(t, false, 4)
+	compact := encode(t, subvolumes)
+
+	if strings.Count(compact, "\n") != 1 || !strings.HasSuffix(compact, "}\n") {
+		t.Errorf("compact JSON is not a single line: %q", compact)
+	}
+	if len(compact) >= len(pretty) {
+		t.Errorf("compact JSON has %d bytes, no fewer than the %d of indented JSON", len(compact), len(pretty))
+	}
+	var prettyValue, compactValue interface{}
+	if err := json.Unmarshal([]byte(pretty), &prettyValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(compact), &compactValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(prettyValue, compactValue) {
+		t.Errorf("compact JSON %s parses differently from indented JSON %s", compact, pretty)
+	}
+}
+
+// jsonKeys returns the sorted keys of the JSON object data.
+func jsonKeys(t *testing.T, data []byte) []string {
+	t.Helper()
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOptionalFields(t *testing.T) {
+	summaryKeys := []string{"ActiveChunkExtents", "ActiveExtents", "NumActiveBlocks", "NumActiveVoxels",
+		"NumSubvolumes", "NumTotalBlocks", "Params", "SubvolsPruned", "Subvolumes"}
+	subvolumeKeys := []string{"ActiveBlocks", "FillFraction", "ID", "Key", "MaxChunk", "MaxPoint",
+		"MinChunk", "MinPoint", "TotalBlocks"}
+	resolution := [3]float64{8, 8, 8}
+	tests := []struct {
+		name                    string
+		edit                    func(*Options)
+		summaryKeys, subvolKeys []string
+	}{
+		{"default", func(*Options) {}, nil, nil},
+		{"adjacency", func(opts *Options) { opts.Adjacency = true }, []string{"Adjacency"}, nil},
+		{"components", func(opts *Options) { opts.Components = true }, []string{"NumComponents"}, []string{"Component"}},
+		// Features needing the spans of each block deduplicate them.
+		{"boundary", func(opts *Options) { opts.Boundary = true }, []string{"DuplicateBlocks"}, []string{"BoundaryBlocks"}},
+		{"subvolume spans", func(opts *Options) { opts.SubvolumeSpans = true }, []string{"DuplicateBlocks"}, []string{"Spans"}},
+		{"resolution", func(opts *Options) { opts.Resolution = &resolution }, []string{"Resolution"}, nil},
+		{"dedup", func(opts *Options) { opts.Dedup = true }, []string{"DuplicateBlocks"}, nil},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.edit(&opts)
+		output := encode(t, partition(t, adjacencySpans, opts))
+
+		// Only the fields of the requested feature are added.
+		want := append(append([]string{}, summaryKeys...), test.summaryKeys...)
+		sort.Strings(want)
+		if got := jsonKeys(t, []byte(output)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got keys %v, want %v", test.name, got, want)
+		}
+		want = append(append([]string{}, subvolumeKeys...), test.subvolKeys...)
+		sort.Strings(want)
+		var decoded struct{ Subvolumes []json.RawMessage }
+		if err := json.Unmarshal([]byte(output), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		for i, subvol := range decoded.Subvolumes {
+			if got := jsonKeys(t, subvol); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got keys %v for subvolume %d, want %v", test.name, got, i, want)
+			}
+		}
+	}
+}
+
+func TestIndent(t *testing.T) {
+	subvolumes := partition(t, []Span{{0, 0, 0, 0}}, testOptions())
+	for _, indent := range []int{0, 1, 2, 4, 8} {
+		setJSON(t, true, indent)
+		output := encode(t, subvolumes)
+		pad := strings.Repeat(" ", indent)
+		if want := "{\n" + pad + `"NumTotalBlocks": 4096,` + "\n"; !strings.HasPrefix(output, want) {
+			t.Errorf("indent %d: got output starting %q, want %q", indent, output[:len(want)], want)
+		}
+
+		// Each line is indented by its nesting depth.
+		depth := 0
+		for i, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			trimmed := strings.TrimLeft(line, " ")
+			if strings.HasPrefix(trimmed, "}") || strings.HasPrefix(trimmed, "]") {
+				depth--
+			}
+			if got, want := len(line)-len(trimmed), depth*indent; got != want {
+				t.Errorf("indent %d: line %d %q is indented by %d spaces, want %d", indent, i+1, line, got, want)
+			}
+			if strings.HasSuffix(line, "{") || strings.HasSuffix(line, "[") {
+				depth++
+			}
+		}
+	}
+}
@@ -0,0 +1,1396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Tuples are (Z, Y, X0, X1).  Coordinates are 64-bit on all platforms so
+// voxel coordinates of large volumes cannot overflow.
+type Span [4]int64
+
+// ReversedPolicy determines how spans with X0 > X1 are handled.
+type ReversedPolicy int
+
+const (
+	// SkipReversed ignores reversed spans, logging a warning.
+	SkipReversed ReversedPolicy = iota
+
+	// RejectReversed makes a reversed span an error.
+	RejectReversed
+
+	// SwapReversed swaps X0 and X1 of reversed spans.
+	SwapReversed
+)
+
+// Options controls how spans are partitioned into subvolumes.  Sizes are
+// given per (x, y, z) axis.
+type Options struct {
+	// Number of blocks along each axis of a subvolume.
+	BatchSize Point3d
+
+	// Number of voxels along each axis of a block.  Unused if NoVoxels is set.
+	BlockSize Point3d
+
+	// If true, no voxel extents or counts are computed: subvolumes only have
+	// block extents, and NumActiveVoxels, ActiveExtents and the block size are
+	// omitted from the output.  Options measured in voxels are not supported.
+	NoVoxels bool
+
+	// Block coordinate at which the grid of subvolumes starts, so subvolume
+	// boundaries fall at Origin + n * BatchSize along each axis.
+	Origin Point3d
+
+	// Format of the span input read by Run: "json" (the default) for a JSON
+	// array of spans, "ndjson" for one JSON span per line, "csv" for one
+	// z,y,x0,x1 span per row, "dvidrle" for DVID's binary sparse volume RLE, or
+	// "points" for a JSON array of [z, y, x] points.  Each point covers the
+	// cube of blocks within Radius of it along each axis, and points input
+	// implies Dedup since cubes may overlap.
+	InputFormat string
+	Radius      int64
+
+	// If non-empty, the input read by Run is a JSON document embedding the
+	// spans at this RFC 6901 JSON pointer, such as "/spans".  A string value
+	// holds the spans in EmbeddedEncoding, "base64" (the default) or "none",
+	// gzipped or not, and any other value is the spans themselves.
+	JSONPointer      string
+	EmbeddedEncoding string
+
+	// Format of the output written by Run: "json" (the default), "csv" for
+	// one row per subvolume, "obj" for a Wavefront OBJ mesh of subvolume
+	// boxes, "dvidroi" for the coalesced spans of the active blocks as a
+	// DVID ROI JSON array, or "npy" for a NumPy array of the active blocks of
+	// each grid cell within the bounding box of the subvolumes, or
+	// "dvidtiles" for the DVID tiles at Scale covering each subvolume.  The
+	// dvidroi format implies Dedup, and npy is only supported in grid mode
+	// without merging, splitting, labels, summaries or count only.
+	OutputFormat string
+
+	// Scale of the dvidtiles output, where a tile covers 2^Scale blocks along
+	// each axis.
+	Scale int
+
+	// If non-nil, npy output also writes the shape of its array and the grid
+	// cell at its origin here as JSON.
+	NPYInfo io.Writer
+
+	// Subvolumes with fewer active blocks are pruned from the output.
+	// NumSubvolumes and NumTotalBlocks only count emitted subvolumes, while
+	// NumActiveBlocks counts every active block.
+	MinActiveBlocks int64
+
+	// If positive, Origin is moved back along each axis until every subvolume
+	// starts on a multiple of Align voxels, which BatchSize * BlockSize must
+	// be a multiple of along each axis.
+	Align int
+
+	// If positive, each subvolume crossing a multiple of ChunkAlign voxels
+	// along any axis is split at those multiples after any merging and
+	// splitting, so no subvolume straddles a storage chunk of that size.
+	// Multiples are of absolute voxel coordinates, not relative to Origin.
+	// ChunkAlign must be a multiple of BlockSize along each axis.  Empty
+	// pieces are dropped, and pruning by MinActiveBlocks applies to the grid
+	// cells before splitting.  Retains all spans in memory and implies Dedup.
+	// Not supported with NoVoxels, labels or weighted spans.
+	ChunkAlign int
+
+	// Number of voxels of padding added to each side of a subvolume's extents,
+	// clamped to the bounding box of the grid.  TotalBlocks and ActiveBlocks
+	// always describe the unpadded subvolume.
+	Halo int
+
+	// If positive, the grid is limited to GridSize subvolumes along each axis
+	// starting at Origin, and spans outside it are an error.
+	GridSize int
+
+	// If non-nil, spans are clipped to this bounding box of blocks, and spans
+	// entirely outside it are dropped.
+	BBox *ChunkExtents3d
+
+	// Physical size of a voxel along each (x, y, z) axis in nanometers,
+	// reported as Resolution if non-nil.  Not otherwise used.
+	Resolution *[3]float64
+
+	// Blocks covered by these spans are never active, even if also covered by
+	// the spans being partitioned.  They are in block coordinates after any
+	// conversion from voxels and clipping to BBox.
+	Exclude []Span
+
+	// If true, blocks covered by more than one span are only counted once.
+	// Spans are retained in memory until all spans are read, then overlapping
+	// or adjacent spans of each row are merged, logging the number of merges.
+	Dedup bool
+
+	// If true, span coordinates are voxels rather than blocks and are divided
+	// by BlockSize before partitioning.  This implies Dedup, since a block is
+	// usually covered by many voxel spans.
+	VoxelCoords bool
+
+	// How spans with X0 > X1 are handled.
+	Reversed ReversedPolicy
+
+	// If true, X1 is the exclusive end of a span rather than its last block,
+	// so spans with X0 == X1 are empty and skipped.  Applied to the input
+	// coordinates, after any swapping of reversed spans.  Not supported for
+	// points input.
+	ExclusiveX bool
+
+	// Axis that input spans run along: "x" (the default) for [z, y, x0, x1],
+	// "y" for [z, x, y0, y1] or "z" for [x, y, z0, z1].  Runs along y or z
+	// are split into a span per block after the other checks of checkSpan,
+	// which apply to the run as if it were along x.  Not supported for
+	// labeled, weighted or points input.
+	RunAxis string
+
+	// If true, spans are read by Run as LabeledSpan and each label is
+	// partitioned separately.  Only JSON input and output are supported.
+	Labeled bool
+
+	// If true, spans are read by Run as WeightedSpan and the total weight of
+	// the blocks of each subvolume is reported as TotalWeight.  Only supported
+	// in grid mode without deduplication, labels or a target number of
+	// subvolumes, and for JSON input.
+	Weighted bool
+
+	// If true, malformed spans read by Run are skipped instead of being an
+	// error.  Input that cannot be parsed any further is always an error.
+	SkipBad bool
+
+	// If positive, spans are read into memory and BatchSize is replaced by a
+	// cubic batch size whose grid has about TargetSubvolumes non-empty
+	// subvolumes, the closest of the sizes targetBatchSize tries.  Only
+	// supported in grid mode.
+	TargetSubvolumes int
+
+	// Partitioning mode: "grid" (the default), "octree", which recursively
+	// halves the bounding box of the active blocks along each axis and emits a
+	// leaf once it covers at most LeafMax active blocks, or "rcb", which
+	// recursively bisects the active blocks into Partitions pieces with about
+	// equal numbers of active blocks.  BatchSize is ignored outside grid mode,
+	// and SubvolsPruned counts empty octree branches instead of empty grid
+	// cells.  Octree and rcb modes retain all spans in memory and imply Dedup.
+	Mode       string
+	LeafMax    int64
+	Partitions int
+
+	// If positive, runs of adjacent subvolumes along x, then y, then z are
+	// merged into single subvolumes while their combined active blocks are at
+	// most MergeMax.  Subvolumes are only merged if they have the same extents
+	// along the other two axes, so merged subvolumes never overlap.
+	// SubvolsPruned still counts empty grid cells.
+	MergeMax int64
+
+	// If positive, each subvolume with more than MaxActiveBlocks active blocks
+	// is recursively halved along its longest axis until every piece has at
+	// most that many, after any merging.  Empty pieces are dropped.  Retains
+	// all spans in memory and implies Dedup.
+	MaxActiveBlocks int64
+
+	// If true, the indices of the face-adjacent subvolumes of each subvolume
+	// are reported as Adjacency.  Only supported in grid mode without merging
+	// or splitting and for JSON output.
+	Adjacency bool
+
+	// If true, each subvolume is assigned the connected component of
+	// face-adjacent subvolumes it belongs to, and the number of components is
+	// reported as NumComponents.  Supported as for Adjacency.
+	Components bool
+
+	// Extents reported for each subvolume and for the active blocks: "both"
+	// (the default), "blocks" for only ChunkExtents3d, or "voxels" for only
+	// Extents3d.  Only affects JSON and CSV output.
+	Units string
+
+	// If true, MaxPoint and MaxChunk of each subvolume and of the active blocks
+	// are reported one past the last voxel and block, as half-open [min, max)
+	// boxes, so adjacent subvolumes share a bound.  Only affects the extents
+	// reported, not Spans, and only supported for JSON and CSV output.
+	HalfOpen bool
+
+	// If true, the coalesced spans of the active blocks within each subvolume
+	// are reported as its Spans, in block coordinates and excluding any halo.
+	// Retains all spans in memory and implies Dedup.
+	SubvolumeSpans bool
+
+	// If true, Run and Partition check that every active block is in exactly
+	// one subvolume, and that each subvolume's ActiveBlocks counts them,
+	// returning an error naming the first block or subvolume that is not.
+	// Retains all spans in memory, and not supported with pruning, labels,
+	// summaries, count only or PartitionSeq.
+	AssertCover bool
+
+	// If true, the active blocks of each subvolume sharing a face with an active
+	// block of another subvolume are reported as BoundaryBlocks, estimating
+	// the communication between subvolumes.  Only supported in grid mode
+	// without merging or splitting.  Retains all spans in memory and implies
+	// Dedup.
+	Boundary bool
+
+	// Order of the output subvolumes: "scan" (the default) for z, y, x order of
+	// their MinChunk, "morton" for Z-order, or "active-desc" for decreasing
+	// ActiveBlocks with ties in scan order.
+	//
+	// Output is deterministic: the same spans and options give byte-identical
+	// output whatever the order of the input spans or the number of Parallel
+	// workers, as subvolumes are always ordered by their MinChunk before any
+	// other order is applied, and retained spans are sorted and coalesced.
+	Order string
+
+	// Number of goroutines used to ingest spans, or 0 for one per CPU.
+	Parallel int
+
+	// If true, only the summary counts are computed and the list of
+	// subvolumes is left empty.
+	Summary bool
+
+	// If true, Run only writes the block and subvolume counts, skipping even
+	// the bounding box scan for SubvolsPruned.  Only supported in grid mode
+	// without labels and with JSON output.
+	CountOnly bool
+
+	// If non-empty, Run writes each subvolume as JSON to its own file
+	// subvolume_<ID>.json in this directory, followed by an index.json listing
+	// them, instead of writing the subvolumes to its writer.  The directory is
+	// created if needed and must not already hold subvolume files.  Only
+	// supported without labels, summaries or count only, and for JSON output.
+	SplitDir string
+
+	// If true, Run writes the Subvolumes array of JSON output first, writing
+	// and flushing each subvolume as it is produced, followed by the other
+	// fields.  In grid mode with scan order and no merging, splitting or
+	// coalesced output, no slice of every subvolume is ever built.  Only
+	// supported without labels, summaries, count only, adjacency, components,
+	// AssertCover (which needs every subvolume at once, as for PartitionSeq)
+	// or a split directory, and for JSON output.
+	Stream bool
+
+	// If true, Run returns ErrEmpty instead of writing a partition with no
+	// subvolumes.
+	FailOnEmpty bool
+
+	// Diagnostic messages are written here if non-nil.
+	Logger *log.Logger
+
+	// Least severe level of messages written to Logger, by default all.
+	LogLevel LogLevel
+
+	// Maps reused by accumulators, set by Partitioner.
+	pool *sync.Pool
+
+	// Phase durations of a run logged at debug level, or nil.
+	timer *phaseTimer
+}
+
+func (opts Options) validate() error {
+	if _, found := spanDecoders[opts.inputFormat()]; !found {
+		return fmt.Errorf("unknown input format %q", opts.InputFormat)
+	}
+	if _, found := subvolumeEncoders[opts.outputFormat()]; !found && spanEncoders[opts.outputFormat()] == nil {
+		return fmt.Errorf("unknown output format %q", opts.OutputFormat)
+	}
+	if err := validateOrder(opts.order()); err != nil {
+		return err
+	}
+	if err := validateUnits(opts.units()); err != nil {
+		return err
+	}
+	if err := validateMode(opts); err != nil {
+		return err
+	}
+	if err := validateEmbedded(opts); err != nil {
+		return err
+	}
+	if err := validateRadius(opts); err != nil {
+		return err
+	}
+	if opts.ExclusiveX && opts.inputFormat() == "points" {
+		return fmt.Errorf("exclusive x is not supported for points input")
+	}
+	if err := validateRunAxis(opts); err != nil {
+		return err
+	}
+	if err := validateScale(opts); err != nil {
+		return err
+	}
+	if err := validateAlign(opts); err != nil {
+		return err
+	}
+	if err := validateChunkAlign(opts); err != nil {
+		return err
+	}
+	if (opts.Adjacency || opts.Components) && (opts.mode() != gridMode || opts.MergeMax > 0 || opts.MaxActiveBlocks > 0 || opts.ChunkAlign > 0 || opts.outputFormat() != "json") {
+		return fmt.Errorf("adjacency and components are only supported in grid mode without merging or splitting and with json output")
+	}
+	if opts.Boundary && (opts.mode() != gridMode || opts.MergeMax > 0 || opts.MaxActiveBlocks > 0 || opts.ChunkAlign > 0) {
+		return fmt.Errorf("boundary blocks are only supported in grid mode without merging or splitting")
+	}
+	if opts.SubvolumeSpans && (opts.Labeled || opts.Summary || opts.CountOnly || opts.outputFormat() != "json") {
+		return fmt.Errorf("coalesced output is only supported without labels, summaries or count only and with json output")
+	}
+	if opts.CountOnly && (opts.mode() != gridMode || opts.MergeMax > 0 || opts.MaxActiveBlocks > 0 || opts.ChunkAlign > 0 || opts.Labeled || opts.outputFormat() != "json") {
+		return fmt.Errorf("count only is only supported in grid mode without merging, splitting or labels and with json output")
+	}
+	if opts.NoVoxels && (opts.Units == voxelUnits || opts.VoxelCoords || opts.Align > 0 || opts.Halo > 0 || opts.Resolution != nil || opts.outputFormat() == "obj") {
+		return fmt.Errorf("no voxels is not supported with voxel units or coordinates, alignment, halos, a resolution or obj output")
+	}
+	if opts.outputFormat() == "npy" && (opts.mode() != gridMode || opts.MergeMax > 0 || opts.MaxActiveBlocks > 0 || opts.ChunkAlign > 0 || opts.Labeled || opts.Summary || opts.CountOnly) {
+		return fmt.Errorf("npy output is only supported in grid mode without merging, splitting, labels, summaries or count only")
+	}
+	if opts.AssertCover && (opts.MinActiveBlocks > 0 || opts.Labeled || opts.Summary || opts.CountOnly) {
+		return fmt.Errorf("asserting cover is not supported with a minimum of active blocks, labels, summaries or count only")
+	}
+	if opts.HalfOpen && opts.outputFormat() != "json" && opts.outputFormat() != "csv" {
+		return fmt.Errorf("half-open extents are only supported for json and csv output")
+	}
+	if opts.Stream && (opts.Labeled || opts.Summary || opts.CountOnly || opts.Adjacency || opts.Components || opts.AssertCover || opts.SplitDir != "" || opts.outputFormat() != "json") {
+		return fmt.Errorf("streaming is only supported without labels, summaries, count only, adjacency, components, asserting cover or a split directory and with json output")
+	}
+	if opts.SplitDir != "" && (opts.Labeled || opts.Summary || opts.CountOnly || opts.outputFormat() != "json") {
+		return fmt.Errorf("a split directory is only supported without labels, summaries or count only and with json output")
+	}
+	if opts.TargetSubvolumes > 0 && (opts.mode() != gridMode || opts.Labeled) {
+		return fmt.Errorf("a target number of subvolumes is only supported in grid mode without labels")
+	}
+	if opts.Weighted {
+		if _, found := weightedSpanDecoders[opts.inputFormat()]; !found {
+			return fmt.Errorf("input format %q does not support weighted spans", opts.inputFormat())
+		}
+		if opts.mode() != gridMode || opts.dedup() || opts.Labeled || opts.TargetSubvolumes > 0 {
+			return fmt.Errorf("weighted spans are only supported in grid mode without deduplication, labels or a target number of subvolumes")
+		}
+	}
+	if opts.Labeled {
+		if _, found := labeledSpanDecoders[opts.inputFormat()]; !found {
+			return fmt.Errorf("input format %q does not support labeled spans", opts.inputFormat())
+		}
+		if opts.outputFormat() != "json" {
+			return fmt.Errorf("output format %q does not support labeled spans", opts.outputFormat())
+		}
+	}
+	for i, axis := range "xyz" {
+		if opts.BatchSize[i] <= 0 {
+			return fmt.Errorf("batch size along %c must be positive, got %d", axis, opts.BatchSize[i])
+		}
+		if opts.BlockSize[i] <= 0 && !opts.NoVoxels {
+			return fmt.Errorf("block size along %c must be positive, got %d", axis, opts.BlockSize[i])
+		}
+	}
+	if opts.MergeMax < 0 {
+		return fmt.Errorf("merge maximum must not be negative, got %d", opts.MergeMax)
+	}
+	if opts.MaxActiveBlocks < 0 {
+		return fmt.Errorf("maximum active blocks must not be negative, got %d", opts.MaxActiveBlocks)
+	}
+	if opts.Resolution != nil {
+		for i, axis := range "xyz" {
+			if !(opts.Resolution[i] > 0) {
+				return fmt.Errorf("resolution along %c must be positive, got %g", axis, opts.Resolution[i])
+			}
+		}
+	}
+	if opts.Halo < 0 {
+		return fmt.Errorf("halo must not be negative, got %d", opts.Halo)
+	}
+	return nil
+}
+
+func (opts Options) inputFormat() string {
+	if opts.InputFormat == "" {
+		return "json"
+	}
+	return opts.InputFormat
+}
+
+func (opts Options) outputFormat() string {
+	if opts.OutputFormat == "" {
+		return "json"
+	}
+	return opts.OutputFormat
+}
+
+// badSpan logs and skips a malformed span if opts.SkipBad is set, and
+// otherwise returns err.
+func (opts Options) badSpan(err error) error {
+	if !opts.SkipBad {
+		return err
+	}
+	opts.warnf("Skipping malformed input: %s", err.Error())
+	return nil
+}
+
+// skipBad returns a handler of malformed spans for the decoders that calls
+// skip for each span opts.badSpan skips, so it is counted as a span of the
+// input.
+func (opts Options) skipBad(skip func()) func(error) error {
+	return func(err error) error {
+		if err := opts.badSpan(err); err != nil {
+			return err
+		}
+		skip()
+		return nil
+	}
+}
+
+// sliceSpans returns a producer of spans, which are never malformed.
+func sliceSpans(spans []Span) func(fn func(Span) error, skip func()) error {
+	return func(fn func(Span) error, skip func()) error {
+		for _, span := range spans {
+			if err := fn(span); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// checkSpans returns a producer that passes on the spans from produce after
+// checking each with checkSpan and removing any blocks in opts.Exclude.
+// produce calls skip for each malformed span it skips, so spans are numbered
+// by their position in the input in errors.
+func (opts Options) checkSpans(ctx context.Context, produce func(fn func(Span) error, skip func()) error) func(fn func(Span) error) error {
+	return func(fn func(Span) error) error {
+		var index int64
+		skip := func() { index++ }
+		progress := progress{ctx: ctx, opts: opts}
+		exclude := newExclusion(opts.Exclude)
+		add := func(span Span) error {
+			if err := progress.add(span); err != nil {
+				return err
+			}
+			return exclude.subtract(span, fn)
+		}
+		clipAdd := func(span Span) error {
+			if span, ok := opts.clipSpan(span); ok {
+				return add(span)
+			}
+			return nil
+		}
+		err := produce(func(span Span) error {
+			if opts.runAxis() != xRuns {
+				run, ok, err := opts.checkRun(index, span)
+				index++
+				if !ok {
+					return err
+				}
+				return opts.runSpans(run, clipAdd)
+			}
+			span, ok, err := opts.checkRun(index, span)
+			index++
+			if !ok {
+				return err
+			}
+			if opts.Radius > 0 {
+				// Points are grown once they are in block coordinates.
+				return expandPoint(span, opts.Radius, clipAdd)
+			}
+			return clipAdd(span)
+		}, skip)
+		progress.done()
+		return err
+	}
+}
+
+// progressInterval is the number of spans between progress messages.
+const progressInterval = 1000000
+
+// cancelInterval is the number of spans between checks for cancellation.
+const cancelInterval = 4096
+
+// progress logs the number of spans read so far, and the blocks they cover, so
+// long runs show signs of life.  It also stops ingestion once ctx is done.
+type progress struct {
+	ctx           context.Context
+	opts          Options
+	spans, blocks int64
+}
+
+// add counts span, returning ctx.Err() if ctx is done.
+func (p *progress) add(span Span) error {
+	p.spans++
+	if span[2] <= span[3] {
+		p.blocks += span[3] - span[2] + 1
+	}
+	if p.spans%progressInterval == 0 {
+		p.opts.debugf("Read %d spans covering %d blocks", p.spans, p.blocks)
+	}
+	if p.spans%cancelInterval == 0 {
+		return p.ctx.Err()
+	}
+	return nil
+}
+
+func (p *progress) done() {
+	p.opts.logf("Read %d spans covering %d blocks in total", p.spans, p.blocks)
+	p.opts.timer.done("parse")
+}
+
+func (opts Options) dedup() bool {
+	return opts.Dedup || opts.VoxelCoords || opts.inputFormat() == "points" || opts.retainSpans()
+}
+
+// retainSpans returns true if finish keeps the coalesced spans, for modes and
+// output formats that need the active blocks themselves.
+func (opts Options) retainSpans() bool {
+	return opts.mode() != gridMode || opts.MaxActiveBlocks > 0 || opts.ChunkAlign > 0 || opts.Boundary || opts.SubvolumeSpans || opts.AssertCover || spanEncoders[opts.outputFormat()] != nil
+}
+
+// checkSpan handles a span with X0 > X1 according to opts.Reversed, converts
+// voxel coordinates to blocks and clips the span to opts.BBox, returning the span to add or false if it should
+// be skipped.  index is the position of the span in the input.
+func (opts Options) checkSpan(index int64, span Span) (Span, bool, error) {
+	span, ok, err := opts.checkRun(index, span)
+	if !ok {
+		return span, false, err
+	}
+	span, ok = opts.clipSpan(span)
+	return span, ok, nil
+}
+
+// checkRun is checkSpan without the clipping, for a run along opts.RunAxis.
+func (opts Options) checkRun(index int64, span Span) (Span, bool, error) {
+	if span[2] > span[3] {
+		start, end := opts.runEnds()
+		switch opts.Reversed {
+		case RejectReversed:
+			return span, false, fmt.Errorf("span %d %v has %s > %s", index, span, start, end)
+		case SwapReversed:
+			opts.warnf("Swapping %s and %s of span %d %v", start, end, index, span)
+			span[2], span[3] = span[3], span[2]
+		default:
+			opts.warnf("Skipping span %d %v with %s > %s", index, span, start, end)
+			return span, false, nil
+		}
+	}
+	if opts.ExclusiveX {
+		if span[2] == span[3] {
+			return span, false, nil
+		}
+		span[3]--
+	}
+	if opts.VoxelCoords {
+		block := opts.runBlockSize()
+		span = Span{
+			floorDiv(span[0], block[0]),
+			floorDiv(span[1], block[1]),
+			floorDiv(span[2], block[2]),
+			floorDiv(span[3], block[2]),
+		}
+	}
+	return span, true, nil
+}
+
+// clipSpan clips span to opts.BBox, returning false if nothing is left.
+func (opts Options) clipSpan(span Span) (Span, bool) {
+	if opts.BBox != nil {
+		clipped := clipSpans([]Span{span}, *opts.BBox)
+		if len(clipped) == 0 {
+			return span, false
+		}
+		span = clipped[0]
+	}
+	return span, true
+}
+
+// workers returns the number of goroutines used to ingest spans.
+func (opts Options) workers() int {
+	if opts.Parallel <= 0 {
+		return runtime.NumCPU()
+	}
+	return opts.Parallel
+}
+
+// Partition groups the blocks covered by spans into subvolumes of
+// opts.BatchSize blocks, returning only the subvolumes with active blocks.
+//
+// Partition returns ctx.Err() if ctx is done before all spans are added.
+func Partition(ctx context.Context, spans []Span, opts Options) (subvolumesT, error) {
+	if err := opts.validate(); err != nil {
+		return subvolumesT{}, err
+	}
+	acc, err := accumulate(ctx, opts, sliceSpans(spans))
+	if err != nil {
+		return subvolumesT{}, err
+	}
+	defer acc.release()
+	subvolumes := acc.subvolumes()
+	return subvolumes, subvolumes.coverErr
+}
+
+// spanBatchSize is the number of spans handed to an ingestion worker at once.
+const spanBatchSize = 4096
+
+// accumulate adds every span passed to fn by produce to an accumulator.  With
+// more than one worker, batches of spans are added to per-worker accumulators
+// in parallel and then merged.
+func accumulate(ctx context.Context, opts Options, produce func(fn func(Span) error, skip func()) error) (*accumulator, error) {
+	opts.Origin = opts.alignedOrigin()
+	checked := opts.checkSpans(ctx, produce)
+	if opts.TargetSubvolumes > 0 {
+		var spans []Span
+		err := checked(func(span Span) error {
+			spans = append(spans, span)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		size := targetBatchSize(spans, opts.Origin, opts.TargetSubvolumes)
+		opts.logf("Using batch size %d for about %d subvolumes", size, opts.TargetSubvolumes)
+		opts.BatchSize = Point3d{size, size, size}
+		checked = func(fn func(Span) error) error {
+			for _, span := range spans {
+				if err := fn(span); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	workers := opts.workers()
+	if workers == 1 {
+		acc := newAccumulator(opts)
+		if err := checked(acc.add); err != nil {
+			return nil, err
+		}
+		return acc, acc.finish()
+	}
+
+	batches := make(chan []Span, workers)
+	accs := make([]*accumulator, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range accs {
+		accs[i] = newAccumulator(opts)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for batch := range batches {
+				for _, span := range batch {
+					if errs[i] == nil {
+						errs[i] = accs[i].add(span)
+					}
+				}
+			}
+		}(i)
+	}
+
+	batch := make([]Span, 0, spanBatchSize)
+	err := checked(func(span Span) error {
+		batch = append(batch, span)
+		if len(batch) == spanBatchSize {
+			batches <- batch
+			batch = make([]Span, 0, spanBatchSize)
+		}
+		return nil
+	})
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, acc := range accs[1:] {
+		accs[0].merge(acc)
+		acc.release()
+	}
+	return accs[0], accs[0].finish()
+}
+
+// accumulator counts active blocks within each subvolume, keyed by the
+// subvolume's (x, y, z) grid index.  Only occupied subvolumes are stored, and
+// each is recorded in cells the first time it becomes active.
+//
+// If opts.dedup() is true, spans are instead retained until finish, which counts
+// each covered block once after coalescing overlapping spans.
+type accumulator struct {
+	opts            Options
+	active          map[Point3d]int64
+	cells           []Point3d
+	numActiveBlocks int64
+
+	// Bounding box of all active blocks, valid if numActiveBlocks > 0.
+	activeChunks ChunkExtents3d
+
+	// Spans retained for deduplication and the number of blocks they cover,
+	// including duplicates.  If opts.retainSpans() is true, finish leaves the
+	// coalesced spans here.
+	spans         []Span
+	coveredBlocks int64
+
+	// Total weight of the blocks within each subvolume and overall, if
+	// opts.Weighted is set.
+	weights     map[Point3d]float64
+	totalWeight float64
+
+	// Active blocks of each subvolume sharing a face with an active block of
+	// another, counted by finish if opts.Boundary is set.
+	boundary map[Point3d]int64
+}
+
+func newAccumulator(opts Options) *accumulator {
+	if opts.NoVoxels {
+		// Leaves the voxel extents of subvolumes zero.
+		opts.BlockSize = Point3d{}
+	}
+	acc := &accumulator{
+		opts:   opts,
+		active: opts.activeMap(),
+	}
+	if opts.Weighted {
+		acc.weights = make(map[Point3d]float64)
+	}
+	return acc
+}
+
+// add marks the blocks covered by span as active.
+func (acc *accumulator) add(span Span) error {
+	if acc.opts.dedup() {
+		if span[2] <= span[3] {
+			acc.spans = append(acc.spans, span)
+			acc.coveredBlocks += span[3] - span[2] + 1
+		}
+		return nil
+	}
+	return acc.count(span)
+}
+
+// count adds the blocks covered by span to the active block counts.
+func (acc *accumulator) count(span Span) error {
+	return acc.countWeighted(span, 0)
+}
+
+// countWeighted is count for a span whose blocks each have the given weight,
+// which is added to the subvolume weights if opts.Weighted is set.
+func (acc *accumulator) countWeighted(span Span, weight float64) error {
+	batch, origin := acc.opts.BatchSize, acc.opts.Origin
+	z := span[0]
+	y := span[1]
+	x0 := span[2]
+	x1 := span[3]
+
+	gz := floorDiv(z-origin[2], batch[2])
+	gy := floorDiv(y-origin[1], batch[1])
+	if err := acc.checkGrid('z', z, gz); err != nil {
+		return err
+	}
+	if err := acc.checkGrid('y', y, gy); err != nil {
+		return err
+	}
+	if x0 > x1 {
+		return nil
+	}
+
+	acc.extendActive(span)
+
+	// Add the blocks of the span falling within each grid cell along x at once.
+	gx0 := floorDiv(x0-origin[0], batch[0])
+	gx1 := floorDiv(x1-origin[0], batch[0])
+	if err := acc.checkGrid('x', x0, gx0); err != nil {
+		return err
+	}
+	if err := acc.checkGrid('x', x1, gx1); err != nil {
+		return err
+	}
+	for gx := gx0; gx <= gx1; gx++ {
+		lo := origin[0] + gx*batch[0]
+		hi := lo + batch[0] - 1
+		if lo < x0 {
+			lo = x0
+		}
+		if hi > x1 {
+			hi = x1
+		}
+		n := hi - lo + 1
+		cell := Point3d{gx, gy, gz}
+		if acc.active[cell] == 0 {
+			acc.cells = append(acc.cells, cell)
+		}
+		acc.active[cell] += n
+		acc.numActiveBlocks += n
+		if acc.weights != nil {
+			acc.weights[cell] += weight * float64(n)
+			acc.totalWeight += weight * float64(n)
+		}
+	}
+	return nil
+}
+
+// extendActive grows the bounding box of active blocks to include span.
+func (acc *accumulator) extendActive(span Span) {
+	lo := Point3d{span[2], span[1], span[0]}
+	hi := Point3d{span[3], span[1], span[0]}
+	if acc.numActiveBlocks == 0 {
+		acc.activeChunks = ChunkExtents3d{lo, hi}
+		return
+	}
+	acc.activeChunks.extend(ChunkExtents3d{lo, hi})
+}
+
+// extend grows extents to include other.
+func (extents *ChunkExtents3d) extend(other ChunkExtents3d) {
+	for i := range extents.MinChunk {
+		if other.MinChunk[i] < extents.MinChunk[i] {
+			extents.MinChunk[i] = other.MinChunk[i]
+		}
+		if other.MaxChunk[i] > extents.MaxChunk[i] {
+			extents.MaxChunk[i] = other.MaxChunk[i]
+		}
+	}
+}
+
+// checkGrid returns an error if the block coordinate coord along axis falls in
+// grid index cell outside a bounded grid of opts.GridSize cells.
+func (acc *accumulator) checkGrid(axis rune, coord, cell int64) error {
+	size := int64(acc.opts.GridSize)
+	if size > 0 && (cell < 0 || cell >= size) {
+		return fmt.Errorf("block %c coordinate %d falls in grid index %d, outside the grid size limit of %d subvolumes along %c",
+			axis, coord, cell, size, axis)
+	}
+	return nil
+}
+
+// merge adds the active blocks counted by other to acc.
+func (acc *accumulator) merge(other *accumulator) {
+	for _, cell := range other.cells {
+		if acc.active[cell] == 0 {
+			acc.cells = append(acc.cells, cell)
+		}
+		acc.active[cell] += other.active[cell]
+		if acc.weights != nil {
+			acc.weights[cell] += other.weights[cell]
+		}
+	}
+	acc.totalWeight += other.totalWeight
+	if other.numActiveBlocks > 0 {
+		if acc.numActiveBlocks == 0 {
+			acc.activeChunks = other.activeChunks
+		} else {
+			acc.activeChunks.extend(other.activeChunks)
+		}
+	}
+	acc.numActiveBlocks += other.numActiveBlocks
+	acc.spans = append(acc.spans, other.spans...)
+	acc.coveredBlocks += other.coveredBlocks
+}
+
+// finish counts any spans retained for deduplication, once all spans have been
+// added.
+func (acc *accumulator) finish() error {
+	if !acc.opts.dedup() {
+		return nil
+	}
+	numSpans := len(acc.spans)
+	spans := coalesceSpans(acc.spans)
+	acc.opts.logf("Merged %d overlapping or adjacent spans, leaving %d", numSpans-len(spans), len(spans))
+	for _, span := range spans {
+		if err := acc.count(span); err != nil {
+			return err
+		}
+	}
+	acc.spans = nil
+	if acc.opts.Boundary {
+		acc.boundary = acc.boundaryBlocks(spans)
+	}
+	if acc.opts.retainSpans() {
+		acc.spans = spans
+	}
+	return nil
+}
+
+// subvolumes returns the partitioning of all blocks added so far.
+func (acc *accumulator) subvolumes() subvolumesT {
+	batch, block := acc.opts.BatchSize, acc.opts.BlockSize
+	batchBlocks := batch[0] * batch[1] * batch[2]
+
+	cells := acc.emittedCells()
+	numSubvolumes := len(cells)
+
+	subvolumes := subvolumesT{
+		NumTotalBlocks:  int64(numSubvolumes) * batchBlocks,
+		NumActiveBlocks: acc.numActiveBlocks,
+		NumSubvolumes:   numSubvolumes,
+		Params: paramsT{
+			BatchSize: batch,
+			Origin:    acc.opts.Origin,
+			Mode:      acc.opts.mode(),
+			HalfOpen:  acc.opts.HalfOpen,
+		},
+		Resolution: acc.opts.Resolution,
+		Subvolumes: []subvolumeT{},
+	}
+	if !acc.opts.NoVoxels {
+		activeVoxels := acc.numActiveBlocks * block[0] * block[1] * block[2]
+		subvolumes.NumActiveVoxels = &activeVoxels
+		subvolumes.Params.BlockSize = &block
+	}
+
+	// Empty subvolumes within the grid cells spanned by the active blocks are
+	// pruned.  They are never visited, so count them as bounding box cells minus
+	// emitted cells.
+	bounds, boxCells := acc.gridBounds()
+	if boxCells > 0 {
+		subvolumes.SubvolsPruned = boxCells - int64(numSubvolumes)
+	}
+	if acc.opts.Weighted {
+		totalWeight := acc.totalWeight
+		subvolumes.TotalWeight = &totalWeight
+	}
+	if acc.opts.dedup() {
+		duplicates := acc.coveredBlocks - acc.numActiveBlocks
+		subvolumes.DuplicateBlocks = &duplicates
+	}
+	if acc.numActiveBlocks > 0 {
+		activeChunks := acc.activeChunks
+		subvolumes.ActiveChunkExtents = &activeChunks
+		if !acc.opts.NoVoxels {
+			activeVoxels := voxelExtents(activeChunks, block)
+			subvolumes.ActiveExtents = &activeVoxels
+		}
+	}
+	subvolumes.setUnits(acc.opts.units())
+	if acc.opts.HalfOpen {
+		subvolumes.setHalfOpen()
+	}
+	subvolumes.scale = acc.opts.Scale
+
+	var subvols []subvolumeT
+	sorted := true
+	if acc.opts.mode() != gridMode {
+		var pruned int64
+		subvols, pruned = acc.leafSubvolumes()
+		sorted = false
+		bounds = acc.activeChunks
+		subvolumes.countSubvolumes(subvols)
+		subvolumes.SubvolsPruned = pruned
+	} else {
+		if acc.opts.Summary && acc.opts.MergeMax == 0 && acc.opts.MaxActiveBlocks == 0 && acc.opts.ChunkAlign == 0 && !acc.opts.Components {
+			return subvolumes
+		}
+
+		// Emit all foreground subvolumes in z, y, x order.  Only occupied cells
+		// are visited, so the cost is independent of the size of the bounding box.
+		sortCells(cells)
+		subvols = make([]subvolumeT, 0, numSubvolumes)
+		for _, cell := range cells {
+			subvols = append(subvols, acc.cellSubvolume(cell))
+		}
+	}
+
+	if acc.opts.MergeMax > 0 {
+		subvols = mergeSubvolumes(subvols, acc.opts.MergeMax, block)
+		sorted = false
+		subvolumes.countSubvolumes(subvols)
+	}
+	if acc.opts.MaxActiveBlocks > 0 {
+		subvols = splitSubvolumes(subvols, acc.spans, acc.opts.MaxActiveBlocks, block)
+		sorted = false
+		subvolumes.countSubvolumes(subvols)
+	}
+	if acc.opts.ChunkAlign > 0 {
+		subvols = chunkAlignSubvolumes(subvols, acc.spans, acc.opts.ChunkAlign, block)
+		sorted = false
+		subvolumes.countSubvolumes(subvols)
+	}
+	if acc.opts.Summary {
+		if acc.opts.Components {
+			subvolumes.setComponents(subvols)
+		}
+		return subvolumes
+	}
+
+	if acc.opts.AssertCover {
+		subvolumes.coverErr = checkCover(subvols, acc.spans)
+	}
+	if acc.opts.SubvolumeSpans {
+		for i := range subvols {
+			subvols[i].Spans = boxSpans(acc.spans, subvols[i].ChunkExtents3d)
+		}
+	}
+	if order := acc.opts.order(); order != "scan" || !sorted {
+		subvolumeOrders[order](subvols)
+	}
+	for i := range subvols {
+		subvols[i].ID = i
+		subvols[i].Key = chunkKey(subvols[i].MinChunk)
+		subvols[i].units = acc.opts.units()
+		subvols[i].halfOpen = acc.opts.HalfOpen
+	}
+	subvolumes.Subvolumes = subvols
+	subvolumes.indexCells()
+	if acc.opts.Adjacency {
+		subvolumes.Adjacency = subvolumeAdjacency(subvols)
+	}
+	if acc.opts.Components {
+		subvolumes.setComponents(subvols)
+	}
+	// Subvolumes are ordered, named and connected by their unpadded extents,
+	// as in the summary.
+	if acc.opts.Halo > 0 {
+		voxelBounds := voxelExtents(bounds, block)
+		for i := range subvols {
+			subvols[i].addHalo(acc.opts.Halo, voxelBounds, block)
+		}
+	}
+	return subvolumes
+}
+
+// paramsT holds the effective partitioning parameters: the batch size chosen
+// for Options.TargetSubvolumes and the origin moved by Options.Align rather
+// than the requested values.  HalfOpen records that the maxima of the output
+// extents are exclusive, so the output can be read back.
+type paramsT struct {
+	BatchSize Point3d
+	BlockSize *Point3d `json:",omitempty"`
+	Origin    Point3d
+	Mode      string
+	HalfOpen  bool `json:",omitempty"`
+}
+
+// countsT holds the counts written by Run for Options.CountOnly.
+type countsT struct {
+	NumTotalBlocks  int64
+	NumActiveBlocks int64
+	NumSubvolumes   int
+}
+
+// counts returns the block and subvolume counts without building subvolumes.
+func (acc *accumulator) counts() countsT {
+	batch := acc.opts.BatchSize
+	numSubvolumes := len(acc.cells)
+	if acc.opts.MinActiveBlocks > 0 {
+		numSubvolumes = 0
+		for _, cell := range acc.cells {
+			if acc.active[cell] >= acc.opts.MinActiveBlocks {
+				numSubvolumes++
+			}
+		}
+	}
+	return countsT{
+		NumTotalBlocks:  int64(numSubvolumes) * batch[0] * batch[1] * batch[2],
+		NumActiveBlocks: acc.numActiveBlocks,
+		NumSubvolumes:   numSubvolumes,
+	}
+}
+
+// emittedCells returns the occupied grid cells, without those with fewer than
+// MinActiveBlocks active blocks, which are pruned.
+func (acc *accumulator) emittedCells() []Point3d {
+	if acc.opts.MinActiveBlocks == 0 {
+		return acc.cells
+	}
+	cells := make([]Point3d, 0, len(acc.cells))
+	for _, cell := range acc.cells {
+		if acc.active[cell] >= acc.opts.MinActiveBlocks {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// gridBounds returns the blocks within the grid cells spanned by the active
+// blocks and the number of those cells, which is 0 if no blocks are active.
+func (acc *accumulator) gridBounds() (ChunkExtents3d, int64) {
+	if acc.numActiveBlocks == 0 {
+		return ChunkExtents3d{}, 0
+	}
+	minCell := acc.opts.cell(acc.activeChunks.MinChunk)
+	maxCell := acc.opts.cell(acc.activeChunks.MaxChunk)
+	var boxCells int64 = 1
+	for i := range minCell {
+		boxCells *= maxCell[i] - minCell[i] + 1
+	}
+	return ChunkExtents3d{
+		acc.opts.cellChunks(minCell).MinChunk,
+		acc.opts.cellChunks(maxCell).MaxChunk,
+	}, boxCells
+}
+
+// sortCells sorts grid cells in z, y, x order.
+func sortCells(cells []Point3d) {
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+}
+
+// cellSubvolume returns the unpadded subvolume of grid cell.
+func (acc *accumulator) cellSubvolume(cell Point3d) subvolumeT {
+	subvol := newSubvolume(acc.opts.cellChunks(cell), acc.active[cell], acc.opts.BlockSize)
+	subvol.cell = &cell
+	if acc.opts.Weighted {
+		weight := acc.weights[cell]
+		subvol.TotalWeight = &weight
+	}
+	if acc.boundary != nil {
+		boundary := acc.boundary[cell]
+		subvol.BoundaryBlocks = &boundary
+	}
+	return subvol
+}
+
+// countSubvolumes sets NumSubvolumes and NumTotalBlocks from subvols.
+func (subvolumes *subvolumesT) countSubvolumes(subvols []subvolumeT) {
+	subvolumes.NumSubvolumes = len(subvols)
+	subvolumes.NumTotalBlocks = 0
+	for _, subvol := range subvols {
+		subvolumes.NumTotalBlocks += subvol.TotalBlocks
+	}
+}
+
+// newSubvolume returns the subvolume covering the blocks within chunks, with
+// active of them active.  The voxel extents are left zero for a zero block
+// size.
+func newSubvolume(chunks ChunkExtents3d, active int64, block Point3d) subvolumeT {
+	subvol := subvolumeT{
+		ChunkExtents3d: chunks,
+		TotalBlocks:    chunks.numBlocks(),
+		ActiveBlocks:   active,
+	}
+	if block != (Point3d{}) {
+		subvol.Extents3d = voxelExtents(chunks, block)
+	}
+	subvol.FillFraction = fillFraction(subvol.ActiveBlocks, subvol.TotalBlocks)
+	return subvol
+}
+
+// numBlocks returns the number of blocks within extents.
+func (extents ChunkExtents3d) numBlocks() int64 {
+	n := int64(1)
+	for i := range extents.MinChunk {
+		n *= extents.MaxChunk[i] - extents.MinChunk[i] + 1
+	}
+	return n
+}
+
+// floorDiv returns a / b rounded toward negative infinity, so negative block
+// coordinates fall into negative grid cells instead of sharing cell 0.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// Point3d is an (x, y, z) point.  It marshals to JSON as an [x, y, z] array,
+// or as an {"X": x, "Y": y, "Z": z} object if NamedPointFields is set, and
+// unmarshals from either form.
+type Point3d [3]int64
+
+// NamedPointFields selects the object form when marshalling a Point3d.
+var NamedPointFields bool
+
+type namedPoint3d struct {
+	X, Y, Z int64
+}
+
+func (pt Point3d) MarshalJSON() ([]byte, error) {
+	if NamedPointFields {
+		return json.Marshal(namedPoint3d{pt[0], pt[1], pt[2]})
+	}
+	return json.Marshal([3]int64(pt))
+}
+
+func (pt *Point3d) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var named namedPoint3d
+		if err := json.Unmarshal(trimmed, &named); err != nil {
+			return err
+		}
+		*pt = Point3d{named.X, named.Y, named.Z}
+		return nil
+	}
+	return json.Unmarshal(data, (*[3]int64)(pt))
+}
+
+// Block counts are 64-bit so they cannot overflow on 32-bit platforms or for
+// large batch sizes.
+//
+// JSON output has the fields of subvolumesT and subvolumeT in the order they
+// are declared, and the labels of labeled output in increasing numeric order,
+// so output for the same spans and options is byte for byte the same, as the
+// golden files of testdata check.  New fields are declared next to the fields
+// they relate to, not necessarily last, as ID and Key precede the extents and
+// NumActiveVoxels follows NumActiveBlocks, so the position of a key can change
+// between versions and consumers should find fields by name.
+type subvolumesT struct {
+	NumTotalBlocks  int64
+	NumActiveBlocks int64
+	NumActiveVoxels *int64 `json:",omitempty"`
+	NumSubvolumes   int
+	SubvolsPruned   int64
+
+	// Parameters that produced the partition, after any automatic sizing.
+	Params paramsT
+
+	// Total weight of all active blocks, only reported for weighted spans.
+	TotalWeight *float64 `json:",omitempty"`
+
+	// Number of block coverings beyond the first, only reported when blocks
+	// are deduplicated.
+	DuplicateBlocks *int64 `json:",omitempty"`
+
+	// Bounding box of all active blocks in voxels and blocks, omitted if no
+	// blocks are active.
+	ActiveExtents      *Extents3d      `json:",omitempty"`
+	ActiveChunkExtents *ChunkExtents3d `json:",omitempty"`
+
+	// Physical size of a voxel along each (x, y, z) axis in nanometers, only
+	// reported if given.
+	Resolution *[3]float64 `json:",omitempty"`
+
+	// Number of connected components of face-adjacent subvolumes, only
+	// reported if requested.
+	NumComponents *int `json:",omitempty"`
+
+	Subvolumes []subvolumeT
+
+	// IDs of the face-adjacent subvolumes of each subvolume, indexed by ID and
+	// only reported if requested.
+	Adjacency [][]int `json:",omitempty"`
+
+	// Extents written by encodeCSV, from Options.Units.
+	units string
+
+	// Scale of the tiles written by encodeDVIDTiles, from Options.Scale.
+	scale int
+
+	// Error found by checkCover if Options.AssertCover is set.
+	coverErr error
+
+	// Index of the subvolume of each grid cell, for SubvolumeAt.
+	index map[Point3d]int
+}
+
+type subvolumeT struct {
+	// Position of the subvolume in the output, and a key naming it by the
+	// x_y_z of its MinChunk before any halo is added.
+	ID  int
+	Key string
+
+	Extents3d
+	ChunkExtents3d
+	TotalBlocks  int64
+	ActiveBlocks int64
+
+	// ActiveBlocks / TotalBlocks
+	FillFraction float64
+
+	// Total weight of the active blocks, only reported for weighted spans.
+	TotalWeight *float64 `json:",omitempty"`
+
+	// Active blocks sharing a face with an active block of another subvolume,
+	// only reported if requested.
+	BoundaryBlocks *int64 `json:",omitempty"`
+
+	// Coalesced spans of the active blocks, only reported if requested.
+	Spans []Span `json:",omitempty"`
+
+	// Connected component of face-adjacent subvolumes, numbered from 1 in
+	// output order, or 0 if not requested.
+	Component int `json:",omitempty"`
+
+	// Extents reported by MarshalJSON, from Options.Units.
+	units string
+
+	// Maxima reported as exclusive bounds, from Options.HalfOpen.
+	halfOpen bool
+
+	// Grid cell of the subvolume, or nil if it is not a single grid cell.
+	cell *Point3d
+}
+
+// chunkKey returns the x_y_z key naming a subvolume by its MinChunk.
+func chunkKey(chunk Point3d) string {
+	return fmt.Sprintf("%d_%d_%d", chunk[0], chunk[1], chunk[2])
+}
+
+// cellChunks returns the block extents of the subvolume at grid index cell.
+func (opts Options) cellChunks(cell Point3d) ChunkExtents3d {
+	var extents ChunkExtents3d
+	for i := range cell {
+		extents.MinChunk[i] = opts.Origin[i] + cell[i]*opts.BatchSize[i]
+		extents.MaxChunk[i] = extents.MinChunk[i] + opts.BatchSize[i] - 1
+	}
+	return extents
+}
+
+// cell returns the (x, y, z) grid index of the subvolume containing block.
+func (opts Options) cell(block Point3d) Point3d {
+	var cell Point3d
+	for i := range cell {
+		cell[i] = floorDiv(block[i]-opts.Origin[i], opts.BatchSize[i])
+	}
+	return cell
+}
+
+// voxelExtents returns the voxel extents of the given blocks.
+func voxelExtents(chunks ChunkExtents3d, block Point3d) Extents3d {
+	var extents Extents3d
+	for i := range block {
+		extents.MinPoint[i] = chunks.MinChunk[i] * block[i]
+		extents.MaxPoint[i] = (chunks.MaxChunk[i]+1)*block[i] - 1
+	}
+	return extents
+}
+
+// addHalo grows the voxel extents of subvol by halo voxels on each side,
+// clamped to bounds, and updates its chunk extents to the blocks covering the
+// padded region.  Block counts are left describing the unpadded subvolume.
+func (subvol *subvolumeT) addHalo(halo int, bounds Extents3d, block Point3d) {
+	for i := range subvol.MinPoint {
+		subvol.MinPoint[i] -= int64(halo)
+		if subvol.MinPoint[i] < bounds.MinPoint[i] {
+			subvol.MinPoint[i] = bounds.MinPoint[i]
+		}
+		subvol.MaxPoint[i] += int64(halo)
+		if subvol.MaxPoint[i] > bounds.MaxPoint[i] {
+			subvol.MaxPoint[i] = bounds.MaxPoint[i]
+		}
+		subvol.MinChunk[i] = floorDiv(subvol.MinPoint[i], block[i])
+		subvol.MaxChunk[i] = floorDiv(subvol.MaxPoint[i], block[i])
+	}
+}
+
+// fillFraction returns active / total, or 0 if total is 0.
+func fillFraction(active, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(active) / float64(total)
+}
+
+// Extents defines a 3d volume
+type Extents3d struct {
+	MinPoint Point3d
+	MaxPoint Point3d
+}
+
+// ChunkExtents3d defines a 3d volume of chunks
+type ChunkExtents3d struct {
+	MinChunk Point3d
+	MaxChunk Point3d
+}
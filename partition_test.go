@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testOptions returns the default options of the CLI: subvolumes of 16 blocks
+// of 32 voxels along each axis, with one ingestion worker.
+func testOptions() Options {
+	return Options{
+		BatchSize: Point3d{16, 16, 16},
+		BlockSize: Point3d{32, 32, 32},
+		Parallel:  1,
+	}
+}
+
+// partition partitions spans using opts, failing the test on error.
+func partition(t testing.TB, spans []Span, opts Options) subvolumesT {
+	t.Helper()
+	subvolumes, err := Partition(context.Background(), spans, opts)
+	if err != nil {
+		t.Fatalf("error partitioning %v: %s", spans, err.Error())
+	}
+	return subvolumes
+}
+
+func TestAnisotropicBlockSize(t *testing.T) {
+	spans := []Span{{20, 0, 0, 0}}
+	tests := []struct {
+		block  Point3d
+		extent Extents3d
+	}{
+		{Point3d{32, 32, 32}, Extents3d{MinPoint: Point3d{0, 0, 512}, MaxPoint: Point3d{511, 511, 1023}}},
+		{Point3d{32, 32, 40}, Extents3d{MinPoint: Point3d{0, 0, 640}, MaxPoint: Point3d{511, 511, 1279}}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.BlockSize = test.block
+		subvolumes := partition(t, spans, opts)
+		if len(subvolumes.Subvolumes) != 1 {
+			t.Fatalf("block size %v: got %d subvolumes, want 1", test.block, len(subvolumes.Subvolumes))
+		}
+		subvol := subvolumes.Subvolumes[0]
+		if subvol.Extents3d != test.extent {
+			t.Errorf("block size %v: got voxel extents %v, want %v", test.block, subvol.Extents3d, test.extent)
+		}
+		chunks := ChunkExtents3d{MinChunk: Point3d{0, 0, 16}, MaxChunk: Point3d{15, 15, 31}}
+		if subvol.ChunkExtents3d != chunks {
+			t.Errorf("block size %v: got chunk extents %v, want %v", test.block, subvol.ChunkExtents3d, chunks)
+		}
+	}
+}
+
+func TestLargeBlockCounts(t *testing.T) {
+	// Each subvolume has 2^33 blocks, more than a 32-bit int holds.
+	opts := testOptions()
+	opts.BatchSize = Point3d{2048, 2048, 2048}
+	subvolumes := partition(t, []Span{{0, 0, 0, 0}, {0, 0, 2048, 2048}}, opts)
+	const perSubvolume = int64(1) << 33
+	if subvolumes.NumTotalBlocks != 2*perSubvolume {
+		t.Errorf("got %d total blocks, want %d", subvolumes.NumTotalBlocks, 2*perSubvolume)
+	}
+	for _, subvol := range subvolumes.Subvolumes {
+		if subvol.TotalBlocks != perSubvolume {
+			t.Errorf("subvolume %s has %d total blocks, want %d", subvol.Key, subvol.TotalBlocks, perSubvolume)
+		}
+	}
+}
+
+func TestLargeCoordinates(t *testing.T) {
+	const big = int64(1) << 32 // a multiple of the batch size
+	tests := []struct {
+		name     string
+		span     Span
+		minChunk Point3d
+	}{
+		{"x", Span{0, 0, big + 1, big + 2}, Point3d{big, 0, 0}},
+		{"y", Span{0, big + 1, 0, 0}, Point3d{0, big, 0}},
+		{"z", Span{big + 1, 0, 0, 0}, Point3d{0, 0, big}},
+		{"negative", Span{-big - 1, -big - 1, -big - 2, -big - 1}, Point3d{-big - 16, -big - 16, -big - 16}},
+	}
+	for _, test := range tests {
+		input, err := json.Marshal([]Span{test.span})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var subvolumes struct{ Subvolumes []subvolumeT }
+		if err := json.Unmarshal([]byte(run(t, string(input), testOptions())), &subvolumes); err != nil {
+			t.Fatalf("%s: error parsing output: %s", test.name, err.Error())
+		}
+		if len(subvolumes.Subvolumes) != 1 {
+			t.Fatalf("%s: got %d subvolumes, want 1", test.name, len(subvolumes.Subvolumes))
+		}
+		subvol := subvolumes.Subvolumes[0]
+		if subvol.MinChunk != test.minChunk {
+			t.Errorf("%s: got MinChunk %v, want %v", test.name, subvol.MinChunk, test.minChunk)
+		}
+		for i := range subvol.MinPoint {
+			if want := test.minChunk[i] * 32; subvol.MinPoint[i] != want {
+				t.Errorf("%s: got MinPoint %v, want %d along axis %d", test.name, subvol.MinPoint, want, i)
+			}
+		}
+		if want := test.span[3] - test.span[2] + 1; subvol.ActiveBlocks != want {
+			t.Errorf("%s: got %d active blocks, want %d", test.name, subvol.ActiveBlocks, want)
+		}
+	}
+}
+
+func TestPartitionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"zero batch size", func(opts *Options) { opts.BatchSize[1] = 0 }},
+		{"negative block size", func(opts *Options) { opts.BlockSize[2] = -32 }},
+		{"unknown mode", func(opts *Options) { opts.Mode = "quadtree" }},
+		{"negative halo", func(opts *Options) { opts.Halo = -1 }},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.edit(&opts)
+		if _, err := Partition(context.Background(), []Span{{0, 0, 0, 0}}, opts); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
+
+func TestFillFraction(t *testing.T) {
+	opts := testOptions()
+	opts.BatchSize = Point3d{2, 2, 2}
+	// The first subvolume is dense, and the second has a single block.
+	spans := []Span{{0, 0, 0, 1}, {0, 1, 0, 1}, {1, 0, 0, 1}, {1, 1, 0, 1}, {0, 0, 5, 5}}
+	subvolumes := partition(t, spans, opts)
+	want := []float64{1, 0.125}
+	if len(subvolumes.Subvolumes) != len(want) {
+		t.Fatalf("got %d subvolumes, want %d", len(subvolumes.Subvolumes), len(want))
+	}
+	for i, subvol := range subvolumes.Subvolumes {
+		if subvol.FillFraction != want[i] {
+			t.Errorf("subvolume %s has fill fraction %g, want %g", subvol.Key, subvol.FillFraction, want[i])
+		}
+	}
+	if got := fillFraction(0, 0); got != 0 {
+		t.Errorf("fill fraction of no blocks is %g, want 0", got)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	spans := []Span{{0, 0, 10, 10}}
+	tests := []struct {
+		origin Point3d
+		chunks ChunkExtents3d
+	}{
+		{Point3d{0, 0, 0}, ChunkExtents3d{MinChunk: Point3d{0, 0, 0}, MaxChunk: Point3d{15, 15, 15}}},
+		{Point3d{8, 0, 0}, ChunkExtents3d{MinChunk: Point3d{8, 0, 0}, MaxChunk: Point3d{23, 15, 15}}},
+		{Point3d{12, 3, 0}, ChunkExtents3d{MinChunk: Point3d{-4, -13, 0}, MaxChunk: Point3d{11, 2, 15}}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.Origin = test.origin
+		subvolumes := partition(t, spans, opts)
+		if len(subvolumes.Subvolumes) != 1 {
+			t.Fatalf("origin %v: got %d subvolumes, want 1", test.origin, len(subvolumes.Subvolumes))
+		}
+		subvol := subvolumes.Subvolumes[0]
+		if subvol.ChunkExtents3d != test.chunks {
+			t.Errorf("origin %v: got chunk extents %v, want %v", test.origin, subvol.ChunkExtents3d, test.chunks)
+		}
+		if want := voxelExtents(test.chunks, opts.BlockSize); subvol.Extents3d != want {
+			t.Errorf("origin %v: got voxel extents %v, want %v", test.origin, subvol.Extents3d, want)
+		}
+	}
+}
+
+func TestReversedSpans(t *testing.T) {
+	spans := []Span{{0, 0, 0, 1}, {0, 1, 9, 5}}
+	tests := []struct {
+		policy ReversedPolicy
+		active int64
+		err    string
+	}{
+		{SkipReversed, 2, ""},
+		{SwapReversed, 7, ""},
+		{RejectReversed, 0, "span 1 [0 1 9 5] has X0 > X1"},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.Reversed = test.policy
+		subvolumes, err := Partition(context.Background(), spans, opts)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("policy %d: got error %v, want %q", test.policy, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("policy %d: %s", test.policy, err.Error())
+		}
+		if subvolumes.NumActiveBlocks != test.active {
+			t.Errorf("policy %d: got %d active blocks, want %d", test.policy, subvolumes.NumActiveBlocks, test.active)
+		}
+	}
+
+	// Skipped spans are logged as warnings.
+	var buf bytes.Buffer
+	opts := testOptions()
+	opts.Logger = log.New(&buf, "", 0)
+	partition(t, spans, opts)
+	if want := "WARN Skipping span 1 [0 1 9 5] with X0 > X1"; !strings.Contains(buf.String(), want) {
+		t.Errorf("got log %q, want %q", buf.String(), want)
+	}
+}
+
+func TestExclusiveX(t *testing.T) {
+	tests := []struct {
+		name                 string
+		spans                []Span
+		edit                 func(*Options)
+		inclusive, exclusive int64
+		subvolumes           [2]int
+	}{
+		{"span", []Span{{0, 0, 0, 3}}, func(*Options) {}, 4, 3, [2]int{1, 1}},
+		{"single block", []Span{{0, 0, 5, 5}}, func(*Options) {}, 1, 0, [2]int{1, 0}},
+		{"rows", []Span{{0, 0, 0, 0}, {0, 1, 0, 1}, {0, 2, 0, 2}}, func(*Options) {}, 6, 3, [2]int{1, 1}},
+		{"subvolume boundary", []Span{{0, 0, 15, 16}}, func(*Options) {}, 2, 1, [2]int{2, 1}},
+		{"swapped", []Span{{0, 0, 4, 1}}, func(opts *Options) { opts.Reversed = SwapReversed }, 4, 3, [2]int{1, 1}},
+		{"voxel coords", []Span{{0, 0, 0, 64}}, func(opts *Options) { opts.VoxelCoords = true }, 3, 2, [2]int{1, 1}},
+		{"runs along y", []Span{{0, 0, 0, 3}}, func(opts *Options) { opts.RunAxis = yRuns }, 4, 3, [2]int{1, 1}},
+	}
+	for _, test := range tests {
+		for i, exclusive := range []bool{false, true} {
+			opts := testOptions()
+			test.edit(&opts)
+			opts.ExclusiveX = exclusive
+			subvolumes := partition(t, test.spans, opts)
+			want := test.inclusive
+			if exclusive {
+				want = test.exclusive
+			}
+			if subvolumes.NumActiveBlocks != want {
+				t.Errorf("%s, exclusive %t: got %d active blocks, want %d", test.name, exclusive, subvolumes.NumActiveBlocks, want)
+			}
+			if subvolumes.NumSubvolumes != test.subvolumes[i] {
+				t.Errorf("%s, exclusive %t: got %d subvolumes, want %d", test.name, exclusive, subvolumes.NumSubvolumes, test.subvolumes[i])
+			}
+		}
+	}
+}
+
+func TestVoxelCoords(t *testing.T) {
+	spans := []Span{{40, 0, 0, 63}}
+	tests := []struct {
+		voxels bool
+		active int64
+		chunks ChunkExtents3d
+	}{
+		// Blocks 0 to 63 of row (40, 0), spanning four subvolumes along x.
+		{false, 64, ChunkExtents3d{MinChunk: Point3d{0, 0, 40}, MaxChunk: Point3d{63, 0, 40}}},
+		// Voxels 0 to 63 of row (40, 0), in row (1, 0) of blocks 0 and 1.
+		{true, 2, ChunkExtents3d{MinChunk: Point3d{0, 0, 1}, MaxChunk: Point3d{1, 0, 1}}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.VoxelCoords = test.voxels
+		subvolumes := partition(t, spans, opts)
+		if subvolumes.NumActiveBlocks != test.active {
+			t.Errorf("voxel coords %t: got %d active blocks, want %d", test.voxels, subvolumes.NumActiveBlocks, test.active)
+		}
+		if got := *subvolumes.ActiveChunkExtents; got != test.chunks {
+			t.Errorf("voxel coords %t: got active chunk extents %v, want %v", test.voxels, got, test.chunks)
+		}
+		if got, want := *subvolumes.ActiveExtents, voxelExtents(test.chunks, opts.BlockSize); got != want {
+			t.Errorf("voxel coords %t: got active extents %v, want %v", test.voxels, got, want)
+		}
+	}
+}
+
+// shellSpans returns the spans of the blocks on the faces of a cube of size
+// blocks starting at min along each axis.
+func shellSpans(min, size int64) []Span {
+	max := min + size - 1
+	var spans []Span
+	for z := min; z <= max; z++ {
+		for y := min; y <= max; y++ {
+			if z == min || z == max || y == min || y == max {
+				spans = append(spans, Span{z, y, min, max})
+			} else {
+				spans = append(spans, Span{z, y, min, min}, Span{z, y, max, max})
+			}
+		}
+	}
+	return spans
+}
+
+func TestSubvolsPruned(t *testing.T) {
+	tests := []struct {
+		name   string
+		spans  []Span
+		batch  int64
+		pruned int64
+	}{
+		{"single block at the origin", []Span{{0, 0, 0, 0}}, 1, 0},
+		{"hollow 3-cube", shellSpans(0, 3), 1, 1},
+		{"hollow 5-cube", shellSpans(0, 5), 1, 27},
+		{"hollow 5-cube at -2", shellSpans(-2, 5), 1, 27},
+		// Cells of 2 blocks along each axis: only the center cell is empty.
+		{"hollow 6-cube", shellSpans(0, 6), 2, 1},
+		{"opposite corners", []Span{{0, 0, 0, 0}, {2, 2, 2, 2}}, 1, 25},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.BatchSize = Point3d{test.batch, test.batch, test.batch}
+		subvolumes := partition(t, test.spans, opts)
+		if subvolumes.SubvolsPruned != test.pruned {
+			t.Errorf("%s: got %d subvolumes pruned, want %d", test.name, subvolumes.SubvolsPruned, test.pruned)
+		}
+	}
+}
+
+func TestHaloKeys(t *testing.T) {
+	// Halos clamp the first subvolumes along each axis but not the others, and
+	// a halo wider than a subvolume reaches past its neighbors.
+	want := []string{"0_0_0", "16_0_0", "32_0_0", "96_0_0", "112_0_0", "128_0_0", "0_16_0", "32_32_32"}
+	for _, halo := range []int{0, 32, 600} {
+		for _, order := range []string{"scan", "morton"} {
+			opts := testOptions()
+			opts.Halo = halo
+			opts.Order = order
+			subvolumes := partition(t, adjacencySpans, opts)
+			keys := map[string]bool{}
+			for _, subvol := range subvolumes.Subvolumes {
+				if subvol.Key != chunkKey(opts.cellChunks(*subvol.cell).MinChunk) {
+					t.Errorf("halo %d, %s order: subvolume %d of cell %v has key %s", halo, order, subvol.ID, *subvol.cell, subvol.Key)
+				}
+				keys[subvol.Key] = true
+			}
+			for _, key := range want {
+				if !keys[key] {
+					t.Errorf("halo %d, %s order: no subvolume has key %s", halo, order, key)
+				}
+			}
+		}
+	}
+
+	// Padded subvolumes keep their scan order, whether listed or yielded one
+	// at a time.
+	opts := testOptions()
+	opts.Halo = 600
+	for i, subvol := range partition(t, adjacencySpans, opts).Subvolumes {
+		if subvol.Key != want[i] {
+			t.Errorf("subvolume %d has key %s, want %s", i, subvol.Key, want[i])
+		}
+	}
+	i := 0
+	for subvol, err := range PartitionSeq(context.Background(), adjacencySpans, opts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subvol.Key != want[i] {
+			t.Errorf("PartitionSeq: subvolume %d has key %s, want %s", i, subvol.Key, want[i])
+		}
+		i++
+	}
+}
+
+// genSpans returns the spans written by testdata/genspans.go for a volume of
+// size blocks along each axis, each active with probability density.
+func genSpans(size int, density float64, seed int64) []Span {
+	rng := rand.New(rand.NewSource(seed))
+	var spans []Span
+	for z := 0; z < size; z++ {
+		for y := 0; y < size; y++ {
+			x0 := -1
+			for x := 0; x <= size; x++ {
+				active := x < size && rng.Float64() < density
+				switch {
+				case active && x0 < 0:
+					x0 = x
+				case !active && x0 >= 0:
+					spans = append(spans, Span{int64(z), int64(y), int64(x0), int64(x - 1)})
+					x0 = -1
+				}
+			}
+		}
+	}
+	return spans
+}
+
+// benchmarkVolumes are the generated inputs of the benchmarks.
+var benchmarkVolumes = []struct {
+	size    int
+	density float64
+}{
+	{64, 0.05},
+	{64, 0.5},
+	{128, 0.05},
+}
+
+func BenchmarkPartition(b *testing.B) {
+	for _, volume := range benchmarkVolumes {
+		spans := genSpans(volume.size, volume.density, 1)
+		for _, mode := range []string{gridMode, "octree", "rcb"} {
+			b.Run(fmt.Sprintf("%s/size=%d/density=%g", mode, volume.size, volume.density), func(b *testing.B) {
+				opts := testOptions()
+				opts.Mode = mode
+				opts.LeafMax = 4096
+				opts.Partitions = 64
+				opts.Parallel = 0
+				b.ReportAllocs()
+				for b.Loop() {
+					partition(b, spans, opts)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkOutput(b *testing.B) {
+	for _, volume := range benchmarkVolumes {
+		opts := testOptions()
+		opts.BatchSize = Point3d{4, 4, 4}
+		subvolumes := partition(b, genSpans(volume.size, volume.density, 1), opts)
+		for _, format := range []string{"json", "csv"} {
+			b.Run(fmt.Sprintf("%s/size=%d/density=%g", format, volume.size, volume.density), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := subvolumeEncoders[format](io.Discard, subvolumes); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	for _, volume := range benchmarkVolumes {
+		input, err := json.Marshal(genSpans(volume.size, volume.density, 1))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("size=%d/density=%g", volume.size, volume.density), func(b *testing.B) {
+			opts := testOptions()
+			opts.Parallel = 0
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				if err := Run(context.Background(), bytes.NewReader(input), io.Discard, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSparse partitions 1000 blocks scattered over ever larger volumes,
+// whose cost does not grow with the size of the grid they span.
+func BenchmarkSparse(b *testing.B) {
+	for _, extent := range []int64{1 << 10, 1 << 16, 1 << 24} {
+		rng := rand.New(rand.NewSource(1))
+		spans := make([]Span, 1000)
+		for i := range spans {
+			x := rng.Int63n(extent)
+			spans[i] = Span{rng.Int63n(extent), rng.Int63n(extent), x, x}
+		}
+		b.Run(fmt.Sprintf("extent=%d", extent), func(b *testing.B) {
+			opts := testOptions()
+			b.ReportAllocs()
+			for b.Loop() {
+				partition(b, spans, opts)
+			}
+		})
+	}
+}
+
+func TestParallel(t *testing.T) {
+	// More spans than a worker's batch, some of them overlapping.
+	spans := genSpans(48, 0.4, 3)
+	for _, span := range spans[:2000] {
+		spans = append(spans, Span{span[0], span[1], span[2] + 1, span[3] + 1})
+	}
+	var weighted []WeightedSpan
+	for i, span := range spans {
+		weighted = append(weighted, WeightedSpan{span, float64(i%4) / 2})
+	}
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"grid", func(*Options) {}},
+		{"dedup", func(opts *Options) { opts.Dedup = true }},
+		{"octree", func(opts *Options) { opts.Mode = "octree"; opts.LeafMax = 512 }},
+		{"rcb", func(opts *Options) { opts.Mode = "rcb"; opts.Partitions = 9 }},
+		{"merged", func(opts *Options) { opts.MergeMax = 1000 }},
+		{"weighted", func(opts *Options) { opts.Weighted = true }},
+	}
+	for _, test := range tests {
+		var want subvolumesT
+		for _, parallel := range []int{1, 2, 4, 7} {
+			opts := testOptions()
+			opts.BatchSize = Point3d{8, 8, 8}
+			test.edit(&opts)
+			opts.Parallel = parallel
+			var got subvolumesT
+			if opts.Weighted {
+				var err error
+				if got, err = PartitionWeighted(t.Context(), weighted, opts); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				got = partition(t, spans, opts)
+			}
+			if parallel == 1 {
+				want = got
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %d workers give\n%s\nwant the serial\n%s", test.name, parallel, encode(t, got), encode(t, want))
+			}
+		}
+	}
+}
+
+// BenchmarkParallel partitions a large input with more and more ingestion
+// workers.
+func BenchmarkParallel(b *testing.B) {
+	spans := genSpans(128, 0.5, 1)
+	parallels := []int{1, 2, 4}
+	if n := runtime.NumCPU(); !slices.Contains(parallels, n) {
+		parallels = append(parallels, n)
+	}
+	for _, parallel := range parallels {
+		b.Run(fmt.Sprintf("parallel=%d", parallel), func(b *testing.B) {
+			opts := testOptions()
+			opts.Parallel = parallel
+			for b.Loop() {
+				partition(b, spans, opts)
+			}
+		})
+	}
+}
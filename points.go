@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// seedPoint is a point read by the points input format.  It is encoded in
+// JSON as [z, y, x], matching the order of a span.
+type seedPoint [3]int64
+
+// UnmarshalJSON requires pt to be an array of exactly three integers.
+func (pt *seedPoint) UnmarshalJSON(data []byte) error {
+	values, err := tupleElements(data, len(pt))
+	if err != nil {
+		return err
+	}
+	return parseInts(data, values, pt[:], 0)
+}
+
+// decodePoints reads a JSON array of [z, y, x] points from r, passing each to
+// fn as a span of its single block.  checkSpans grows the spans to cubes of
+// Options.Radius blocks, after any conversion from voxels.
+func decodePoints(r io.Reader, fn func(Span) error, bad func(error) error) error {
+	return decodeJSONArray(r, func(pt seedPoint) error {
+		return fn(Span{pt[0], pt[1], pt[2], pt[2]})
+	}, bad)
+}
+
+// expandPoint passes the cube of half-width radius blocks around the
+// single-block span to fn, as one span per row.
+func expandPoint(span Span, radius int64, fn func(Span) error) error {
+	for z := span[0] - radius; z <= span[0]+radius; z++ {
+		for y := span[1] - radius; y <= span[1]+radius; y++ {
+			if err := fn(Span{z, y, span[2] - radius, span[3] + radius}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateRadius(opts Options) error {
+	if opts.Radius < 0 {
+		return fmt.Errorf("radius must not be negative, got %d", opts.Radius)
+	}
+	if opts.Radius > 0 && opts.inputFormat() != "points" {
+		return fmt.Errorf("a radius is only supported for points input")
+	}
+	return nil
+}
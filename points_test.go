@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPoints(t *testing.T) {
+	tests := []struct {
+		name, input  string
+		radius       int64
+		active, dups int64
+		extents      ChunkExtents3d
+	}{
+		{"point", `[[5,6,7]]`, 0, 1, 0, ChunkExtents3d{Point3d{7, 6, 5}, Point3d{7, 6, 5}}},
+		{"radius 1", `[[5,6,7]]`, 1, 27, 0, ChunkExtents3d{Point3d{6, 5, 4}, Point3d{8, 7, 6}}},
+		{"radius 2", `[[5,6,7]]`, 2, 125, 0, ChunkExtents3d{Point3d{5, 4, 3}, Point3d{9, 8, 7}}},
+		{"across the origin", `[[0,0,0]]`, 1, 27, 0, ChunkExtents3d{Point3d{-1, -1, -1}, Point3d{1, 1, 1}}},
+		// Overlapping cubes are deduplicated.
+		{"overlapping", `[[0,0,0],[0,0,1]]`, 1, 36, 18, ChunkExtents3d{Point3d{-1, -1, -1}, Point3d{2, 1, 1}}},
+		{"same point", `[[3,3,3],[3,3,3]]`, 1, 27, 27, ChunkExtents3d{Point3d{2, 2, 2}, Point3d{4, 4, 4}}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		opts.InputFormat = "points"
+		opts.Radius = test.radius
+		opts.Summary = true
+		var subvolumes subvolumesT
+		if err := json.Unmarshal([]byte(run(t, test.input, opts)), &subvolumes); err != nil {
+			t.Fatalf("%s: error parsing output: %s", test.name, err.Error())
+		}
+		if subvolumes.NumActiveBlocks != test.active {
+			t.Errorf("%s: got %d active blocks, want %d", test.name, subvolumes.NumActiveBlocks, test.active)
+		}
+		if subvolumes.DuplicateBlocks == nil || *subvolumes.DuplicateBlocks != test.dups {
+			t.Errorf("%s: got %v duplicate blocks, want %d", test.name, subvolumes.DuplicateBlocks, test.dups)
+		}
+		if subvolumes.ActiveChunkExtents == nil || *subvolumes.ActiveChunkExtents != test.extents {
+			t.Errorf("%s: got active extents %v, want %v", test.name, subvolumes.ActiveChunkExtents, test.extents)
+		}
+	}
+
+	// With voxel coordinates the radius is still in blocks, around the
+	// point's block.
+	opts := testOptions()
+	opts.InputFormat = "points"
+	opts.Radius = 1
+	opts.VoxelCoords = true
+	opts.Summary = true
+	var subvolumes subvolumesT
+	if err := json.Unmarshal([]byte(run(t, `[[100,100,100]]`, opts)), &subvolumes); err != nil {
+		t.Fatal(err)
+	}
+	want := ChunkExtents3d{Point3d{2, 2, 2}, Point3d{4, 4, 4}}
+	if subvolumes.NumActiveBlocks != 27 || subvolumes.ActiveChunkExtents == nil || *subvolumes.ActiveChunkExtents != want {
+		t.Errorf("voxel coords: got %d active blocks in %v, want 27 in %v", subvolumes.NumActiveBlocks, subvolumes.ActiveChunkExtents, want)
+	}
+
+	// Cubes are clipped to the bounding box.
+	opts = testOptions()
+	opts.InputFormat = "points"
+	opts.Radius = 1
+	opts.BBox = &ChunkExtents3d{Point3d{0, 0, 0}, Point3d{5, 5, 5}}
+	subvolumes = subvolumesT{}
+	if err := json.Unmarshal([]byte(run(t, `[[0,0,0]]`, opts)), &subvolumes); err != nil {
+		t.Fatal(err)
+	}
+	if subvolumes.NumActiveBlocks != 8 {
+		t.Errorf("clipped cube: got %d active blocks, want 8", subvolumes.NumActiveBlocks)
+	}
+
+	bad := []struct {
+		name, input, format string
+		radius              int64
+	}{
+		{"negative radius", `[[0,0,0]]`, "points", -1},
+		{"radius without points", `[[0,0,0,0]]`, "json", 1},
+		{"not a point", `[[0,0]]`, "points", 0},
+		{"span", `[[0,0,0,0]]`, "points", 0},
+	}
+	for _, test := range bad {
+		opts := testOptions()
+		opts.InputFormat = test.format
+		opts.Radius = test.radius
+		if err := Run(t.Context(), strings.NewReader(test.input), &bytes.Buffer{}, opts); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
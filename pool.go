@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Partitioner partitions spans like Partition, reusing the grid maps of its
+// accumulators from one call to the next to reduce allocation when many
+// partitions are computed.  No state other than memory is carried between
+// calls.  The zero value is ready to use, and a Partitioner may be used by
+// several goroutines at once.
+type Partitioner struct {
+	// Cleared maps of active blocks by grid cell.
+	pool sync.Pool
+}
+
+// Partition is the Partition function, reusing the memory of earlier calls.
+func (p *Partitioner) Partition(ctx context.Context, spans []Span, opts Options) (subvolumesT, error) {
+	opts.pool = &p.pool
+	return Partition(ctx, spans, opts)
+}
+
+// activeMap returns an empty map of active blocks by grid cell, reusing one
+// from opts.pool if possible.
+func (opts Options) activeMap() map[Point3d]int64 {
+	if opts.pool != nil {
+		if active, ok := opts.pool.Get().(map[Point3d]int64); ok {
+			return active
+		}
+	}
+	return make(map[Point3d]int64)
+}
+
+// release returns the grid map of acc to opts.pool, if set, once acc is no
+// longer used.
+func (acc *accumulator) release() {
+	if acc.opts.pool == nil || acc.active == nil {
+		return
+	}
+	clear(acc.active)
+	acc.opts.pool.Put(acc.active)
+	acc.active = nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionerReuse(t *testing.T) {
+	// ROIs of more than spanBatchSize spans, so every worker gets some, and
+	// the second far from the first, so no cell of the first may remain.
+	first := genSpans(48, 0.5, 1)
+	var second []Span
+	for _, span := range genSpans(40, 0.3, 2) {
+		second = append(second, Span{span[0] + 1000, span[1] - 70, span[2] + 33, span[3] + 33})
+	}
+	for _, parallel := range []int{1, 4} {
+		opts := testOptions()
+		opts.BatchSize = Point3d{8, 8, 8}
+		opts.Parallel = parallel
+		var p Partitioner
+		for i, spans := range [][]Span{first, second, first} {
+			got, err := p.Partition(t.Context(), spans, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := partition(t, spans, opts)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%d workers: partition %d reusing memory differs from a fresh one:\n%s\nwant\n%s",
+					parallel, i, encode(t, got), encode(t, want))
+			}
+		}
+	}
+}
+
+func BenchmarkPartitioner(b *testing.B) {
+	// Many small ROIs, as when partitioning each segment of a volume.
+	rois := make([][]Span, 100)
+	for i := range rois {
+		rois[i] = genSpans(8, 0.3, int64(i))
+	}
+	opts := testOptions()
+	opts.BatchSize = Point3d{2, 2, 2}
+	b.Run("Partition", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, spans := range rois {
+				partition(b, spans, opts)
+			}
+		}
+	})
+	b.Run("Partitioner", func(b *testing.B) {
+		var p Partitioner
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, spans := range rois {
+				if _, err := p.Partition(b.Context(), spans, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
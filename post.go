@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// postClient sends ROIs to DVID, giving up on a server that does not answer
+// within its timeout.
+var postClient = &http.Client{Timeout: 5 * time.Minute}
+
+// postCommand holds the flags of the post command, which uploads the active
+// blocks of the input as a DVID ROI.  Its flags follow the command.
+type postCommand struct {
+	server string
+	uuid   string
+	name   string
+	dryRun bool
+}
+
+// defineFlags defines the post flags in flags.
+func (post *postCommand) defineFlags(flags *flag.FlagSet) {
+	flags.StringVar(&post.server, "server", "", "DVID server URL, e.g. http://localhost:8000")
+	flags.StringVar(&post.uuid, "uuid", "", "UUID of the DVID node")
+	flags.StringVar(&post.name, "name", "", "Name of the ROI data instance")
+	flags.BoolVar(&post.dryRun, "dryrun", false, "Print the request instead of sending it")
+}
+
+// parseFlags parses the post flags at the start of args, exiting if any are
+// invalid, and returns the remaining input files.
+func (post *postCommand) parseFlags(args []string) []string {
+	flags := commandFlags("post")
+	post.defineFlags(flags)
+	flags.Parse(args)
+	for _, f := range []struct{ name, value string }{
+		{"server", post.server},
+		{"uuid", post.uuid},
+		{"name", post.name},
+	} {
+		if f.value == "" {
+			fmt.Fprintf(flags.Output(), "Error: post requires -%s\n", f.name)
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+	return flags.Args()
+}
+
+// url returns the endpoint of DVID's ROI data instance that accepts spans of
+// blocks.  DVID adds the posted spans to the ROI, and only accepts them with
+// POST rather than PUT.
+func (post *postCommand) url() string {
+	return fmt.Sprintf("%s/api/node/%s/%s/roi", strings.TrimRight(post.server, "/"), post.uuid, post.name)
+}
+
+// send posts the DVID ROI JSON in body to the server, or writes the request to
+// w instead if post.dryRun is set.  The request is abandoned if ctx is done.
+func (post *postCommand) send(ctx context.Context, w io.Writer, body []byte) error {
+	if post.dryRun {
+		if _, err := fmt.Fprintf(w, "POST %s\nContent-Type: application/json\n\n%s", post.url(), body); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, post.url(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting ROI to DVID: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := postClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting ROI to DVID: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("DVID server returned %s for POST %s: %s", resp.Status, post.url(), strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
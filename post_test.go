@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostSend(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if strings.Contains(path, "missing") {
+			http.Error(w, "no such ROI", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	post := postCommand{server: server.URL + "/", uuid: "abc123", name: "roi"}
+	if err := post.send(t.Context(), &bytes.Buffer{}, []byte("[[0,0,0,1]]")); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || path != "/api/node/abc123/roi/roi" || body != "[[0,0,0,1]]" {
+		t.Errorf("got %s %s with body %q, want POST /api/node/abc123/roi/roi with the spans", method, path, body)
+	}
+
+	post.name = "missing"
+	err := post.send(t.Context(), &bytes.Buffer{}, []byte("[]"))
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") || !strings.Contains(err.Error(), "no such ROI") {
+		t.Errorf("got error %v, want the status and message of the server", err)
+	}
+
+	// A dry run writes the request without sending it.
+	method = ""
+	post.dryRun = true
+	var buf bytes.Buffer
+	if err := post.send(t.Context(), &buf, []byte("[]")); err != nil {
+		t.Fatal(err)
+	}
+	if method != "" || !strings.HasPrefix(buf.String(), "POST "+server.URL+"/api/node/abc123/missing/roi\n") {
+		t.Errorf("dry run sent %q and wrote %q", method, buf.String())
+	}
+}
+
+func TestPostCancel(t *testing.T) {
+	// A server that never answers.
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	post := postCommand{server: server.URL, uuid: "abc123", name: "roi"}
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := post.send(ctx, &bytes.Buffer{}, []byte("[]")); err == nil {
+		t.Errorf("got no error from a server that does not answer")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("canceled post took %s", elapsed)
+	}
+}
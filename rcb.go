@@ -0,0 +1,124 @@
+package main
+
+import "sort"
+
+// rcbLeaves splits the blocks covered by spans into n pieces by recursive
+// coordinate bisection.  Each piece is split along the longest axis of its
+// bounding box at the coordinate that best divides its active blocks in
+// proportion to the pieces wanted on each side.  Pieces one block long along
+// every axis are not split further, so fewer than n may be returned.  spans
+// must not overlap, and each piece's extents are the bounding box of its
+// active blocks.
+func rcbLeaves(spans []Span, n int, block Point3d) []subvolumeT {
+	var leaves []subvolumeT
+	var split func(spans []Span, n int)
+	split = func(spans []Span, n int) {
+		box := spanExtents(spans)
+		var active int64
+		for _, span := range spans {
+			active += span[3] - span[2] + 1
+		}
+
+		axis := 0
+		for i := range box.MinChunk {
+			if box.MaxChunk[i]-box.MinChunk[i] > box.MaxChunk[axis]-box.MinChunk[axis] {
+				axis = i
+			}
+		}
+		if n == 1 || box.MinChunk[axis] == box.MaxChunk[axis] {
+			leaves = append(leaves, newSubvolume(box, active, block))
+			return
+		}
+
+		// Split before the coordinate that brings the blocks below it closest to
+		// the share of the first nLow pieces.  Both ends of the bounding box are
+		// active, so neither side is empty.
+		nLow := n / 2
+		target := active * int64(nLow) / int64(n)
+		mid := rcbSplit(spans, axis, box.MinChunk[axis], box.MaxChunk[axis], target)
+
+		low, high := box, box
+		low.MaxChunk[axis] = mid - 1
+		high.MinChunk[axis] = mid
+		split(clipSpans(spans, low), nLow)
+		split(clipSpans(spans, high), n-nLow)
+	}
+	split(spans, n)
+	return leaves
+}
+
+// rcbSplit returns the coordinate between lo+1 and hi along axis before which
+// the blocks of spans come closest to target, the lowest if several do.  The
+// blocks at each coordinate only change where spans start and stop, so the
+// blocks below a coordinate grow linearly between those events, and only the
+// events are visited however long the axis is.
+func rcbSplit(spans []Span, axis int, lo, hi, target int64) int64 {
+	type event struct{ coord, delta int64 }
+	events := make([]event, 0, 2*len(spans))
+	for _, span := range spans {
+		if axis == 0 {
+			events = append(events, event{span[2], 1}, event{span[3] + 1, -1})
+			continue
+		}
+		n := span[3] - span[2] + 1
+		events = append(events, event{span[2-axis], n}, event{span[2-axis] + 1, -n})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].coord < events[j].coord })
+
+	// Splitting before c+1 leaves below + rate*(c-start+1) blocks below it
+	// for each c from the start of a run of equal rate to its end.
+	mid, best := lo+1, int64(-1)
+	var rate, below int64
+	for i := 0; i < len(events); {
+		start := events[i].coord
+		for ; i < len(events) && events[i].coord == start; i++ {
+			rate += events[i].delta
+		}
+		end := hi - 1
+		if i < len(events) && events[i].coord-1 < end {
+			end = events[i].coord - 1
+		}
+		if start > end {
+			break
+		}
+		diff := func(c int64) int64 {
+			d := below + rate*(c-start+1) - target
+			if d < 0 {
+				return -d
+			}
+			return d
+		}
+
+		// The last c with at most target blocks below, or the one after it.
+		c := start
+		if rate > 0 && target >= below {
+			c = min(max(start+(target-below)/rate-1, start), end)
+			if c < end && diff(c+1) < diff(c) {
+				c++
+			}
+		}
+		if best < 0 || diff(c) < best {
+			mid, best = c+1, diff(c)
+		}
+		below += rate * (end - start + 1)
+	}
+	return mid
+}
+
+// spanExtents returns the bounding box of the blocks covered by spans, which
+// must not be empty.
+func spanExtents(spans []Span) ChunkExtents3d {
+	var extents ChunkExtents3d
+	for i, span := range spans {
+		spanChunks := ChunkExtents3d{
+			Point3d{span[2], span[1], span[0]},
+			Point3d{span[3], span[1], span[0]},
+		}
+		if i == 0 {
+			extents = spanChunks
+		} else {
+			extents.extend(spanChunks)
+		}
+	}
+	return extents
+}
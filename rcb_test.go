@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+// TestRCBLongAxes bisects boxes too long for a dense array over an axis, which
+// cannot even be allocated on 32-bit platforms.  Run with GOARCH=386 to check
+// them there.
+func TestRCBLongAxes(t *testing.T) {
+	const long = int64(1) << 40
+	block := Point3d{32, 32, 32}
+	tests := []struct {
+		name   string
+		spans  []Span
+		n      int
+		chunks []ChunkExtents3d
+	}{
+		{"x", []Span{{0, 0, 0, 0}, {0, 0, long, long}}, 2, []ChunkExtents3d{
+			{Point3d{0, 0, 0}, Point3d{0, 0, 0}},
+			{Point3d{long, 0, 0}, Point3d{long, 0, 0}},
+		}},
+		{"y", []Span{{0, 0, 0, 0}, {0, long, 0, 0}}, 2, []ChunkExtents3d{
+			{Point3d{0, 0, 0}, Point3d{0, 0, 0}},
+			{Point3d{0, long, 0}, Point3d{0, long, 0}},
+		}},
+		{"z", []Span{{0, 0, 0, 0}, {long, 0, 0, 0}}, 2, []ChunkExtents3d{
+			{Point3d{0, 0, 0}, Point3d{0, 0, 0}},
+			{Point3d{0, 0, long}, Point3d{0, 0, long}},
+		}},
+		// A single span is split into equal runs.
+		{"span", []Span{{0, 0, 0, long - 1}}, 4, []ChunkExtents3d{
+			{Point3d{0, 0, 0}, Point3d{long/4 - 1, 0, 0}},
+			{Point3d{long / 4, 0, 0}, Point3d{long/2 - 1, 0, 0}},
+			{Point3d{long / 2, 0, 0}, Point3d{3*long/4 - 1, 0, 0}},
+			{Point3d{3 * long / 4, 0, 0}, Point3d{long - 1, 0, 0}},
+		}},
+	}
+	for _, test := range tests {
+		leaves := rcbLeaves(test.spans, test.n, block)
+		if len(leaves) != len(test.chunks) {
+			t.Fatalf("%s: got %d pieces, want %d", test.name, len(leaves), len(test.chunks))
+		}
+		for i, leaf := range leaves {
+			if leaf.ChunkExtents3d != test.chunks[i] {
+				t.Errorf("%s: piece %d has extents %v, want %v", test.name, i, leaf.ChunkExtents3d, test.chunks[i])
+			}
+			if want := leaf.MaxChunk[0] - leaf.MinChunk[0] + 1; leaf.ActiveBlocks != want {
+				t.Errorf("%s: piece %d has %d active blocks, want %d", test.name, i, leaf.ActiveBlocks, want)
+			}
+		}
+	}
+}
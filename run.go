@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrEmpty is returned by Run if Options.FailOnEmpty is set and the partition
+// has no subvolumes.
+var ErrEmpty = errors.New("partition has no subvolumes")
+
+// Source is a named input of spans.  The name prefixes errors decoding its
+// spans, unless it is empty.
+type Source struct {
+	Name   string
+	Reader io.Reader
+}
+
+func (src Source) wrap(err error) error {
+	if src.Name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %s", src.Name, err.Error())
+}
+
+// Run decodes spans from r in opts.InputFormat, partitions them using opts, and
+// writes the resulting subvolumes to w in opts.OutputFormat.  Spans are added to
+// the partition as they are decoded, and gzipped input is decompressed.
+//
+// Run returns ctx.Err() if ctx is done before all spans are added or the
+// output is written.
+func Run(ctx context.Context, r io.Reader, w io.Writer, opts Options) error {
+	return RunSources(ctx, []Source{{Reader: r}}, w, opts)
+}
+
+// RunSources is Run for the union of the spans decoded from each of sources
+// in turn.
+func RunSources(ctx context.Context, sources []Source, w io.Writer, opts Options) error {
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("error partitioning spans: %s", err.Error())
+	}
+	// Writes fail once ctx is done, and any error is then reported as ctx.Err().
+	w = contextWriter{ctx, w}
+	err := runSources(ctx, sources, w, opts)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// runSources logs the time spent parsing the input (including ingestion
+// running alongside), finishing ingestion, partitioning and writing the
+// output, at debug level.
+func runSources(ctx context.Context, sources []Source, w io.Writer, opts Options) (err error) {
+	if opts.Labeled {
+		return runLabeled(ctx, sources, w, opts)
+	}
+	if opts.logging(LogDebug) {
+		opts.timer = newPhaseTimer()
+		defer func() {
+			if err == nil {
+				opts.timer.done("output")
+				opts.timer.log(opts)
+			}
+		}()
+	}
+	acc, err := opts.accumulateSources(ctx, sources)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts.timer.done("ingest")
+	acc.opts.logf("Partitioning in %s mode with batch size %v, block size %v and origin %v (x, y, z)",
+		acc.opts.mode(), acc.opts.BatchSize, acc.opts.BlockSize, acc.opts.Origin)
+	if opts.CountOnly {
+		counts := acc.counts()
+		opts.logf("Found %d active blocks in %d subvolumes", counts.NumActiveBlocks, counts.NumSubvolumes)
+		if opts.FailOnEmpty && counts.NumSubvolumes == 0 {
+			return ErrEmpty
+		}
+		return writeJSON(w, counts)
+	}
+	if encode, found := spanEncoders[opts.outputFormat()]; found {
+		if opts.FailOnEmpty && len(acc.spans) == 0 {
+			return ErrEmpty
+		}
+		return encode(w, acc.spans)
+	}
+	if opts.Stream {
+		summary, subvols := acc.streamSubvolumes()
+		if summary.coverErr != nil {
+			return fmt.Errorf("error checking cover: %s", summary.coverErr.Error())
+		}
+		opts.timer.done("partition")
+		opts.logf("Found %d active blocks in %d subvolumes, pruning %d", summary.NumActiveBlocks, summary.NumSubvolumes, summary.SubvolsPruned)
+		if opts.FailOnEmpty && summary.NumSubvolumes == 0 {
+			return ErrEmpty
+		}
+		return writeStream(ctx, w, summary, subvols)
+	}
+	subvolumes := acc.subvolumes()
+	if subvolumes.coverErr != nil {
+		return fmt.Errorf("error checking cover: %s", subvolumes.coverErr.Error())
+	}
+	opts.timer.done("partition")
+	opts.logf("Found %d active blocks in %d subvolumes, pruning %d", subvolumes.NumActiveBlocks, subvolumes.NumSubvolumes, subvolumes.SubvolsPruned)
+	if opts.FailOnEmpty && subvolumes.NumSubvolumes == 0 {
+		return ErrEmpty
+	}
+	opts.logFillHistogram(subvolumes.Subvolumes)
+	if opts.SplitDir != "" {
+		return writeSplitDir(ctx, opts.SplitDir, subvolumes)
+	}
+	if opts.NPYInfo != nil && opts.outputFormat() == "npy" {
+		// The grid is built once for both the info and the array.
+		grid, err := newNPYGrid(subvolumes)
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(opts.NPYInfo, grid); err != nil {
+			return err
+		}
+		return grid.write(w)
+	}
+	return subvolumeEncoders[opts.outputFormat()](w, subvolumes)
+}
+
+// estimateT holds the quick estimate returned by Estimate.
+type estimateT struct {
+	countsT
+
+	// Batch size of the subvolumes, after any automatic sizing.
+	BatchSize Point3d
+
+	// Bounding box of all active blocks, or nil if no blocks are active.
+	ActiveChunkExtents *ChunkExtents3d
+}
+
+// Estimate decodes and counts the spans of sources as RunSources would, and
+// returns the bounding box of the active blocks and the number of subvolumes
+// the batch size would give, without listing the subvolumes.  It has the
+// limitations of Options.CountOnly.
+func Estimate(ctx context.Context, sources []Source, opts Options) (estimateT, error) {
+	opts.CountOnly = true
+	opts.OutputFormat = ""
+	opts.SplitDir = ""
+	if err := opts.validate(); err != nil {
+		return estimateT{}, fmt.Errorf("error estimating partition: %s", err.Error())
+	}
+	acc, err := opts.accumulateSources(ctx, sources)
+	if err != nil {
+		return estimateT{}, err
+	}
+	estimate := estimateT{countsT: acc.counts(), BatchSize: acc.opts.BatchSize}
+	if acc.numActiveBlocks > 0 {
+		activeChunks := acc.activeChunks
+		estimate.ActiveChunkExtents = &activeChunks
+	}
+	return estimate, nil
+}
+
+// boundsT holds the bounding box returned by BoundingBox.
+type boundsT struct {
+	NumActiveBlocks int64
+
+	// Bounding box of all active blocks in voxels and blocks, omitted if no
+	// blocks are active.  The voxel extents are also omitted for NoVoxels.
+	ActiveExtents      *Extents3d      `json:",omitempty"`
+	ActiveChunkExtents *ChunkExtents3d `json:",omitempty"`
+}
+
+// BoundingBox decodes the spans of sources as RunSources would and returns the
+// bounding box of their active blocks, without listing any subvolumes.  It has
+// the limitations of Options.CountOnly.
+func BoundingBox(ctx context.Context, sources []Source, opts Options) (boundsT, error) {
+	estimate, err := Estimate(ctx, sources, opts)
+	if err != nil {
+		return boundsT{}, err
+	}
+	bounds := boundsT{NumActiveBlocks: estimate.NumActiveBlocks, ActiveChunkExtents: estimate.ActiveChunkExtents}
+	if bounds.ActiveChunkExtents != nil && !opts.NoVoxels {
+		activeVoxels := voxelExtents(*bounds.ActiveChunkExtents, opts.BlockSize)
+		bounds.ActiveExtents = &activeVoxels
+	}
+	return bounds, nil
+}
+
+// overlapT holds the overlap report returned by Overlap.
+type overlapT struct {
+	// Blocks covered by the spans, counting a block once per covering span.
+	CoveredBlocks int64
+
+	// Distinct blocks covered by the spans.
+	UniqueBlocks int64
+
+	// Fraction of the coverings that repeat an already covered block, from 0
+	// for no overlap towards 1.
+	OverlapRatio float64
+}
+
+// Overlap decodes the spans of sources as RunSources would and reports how
+// much they overlap, as counted by Options.Dedup, without partitioning them.
+// It has the limitations of Options.CountOnly.
+func Overlap(ctx context.Context, sources []Source, opts Options) (overlapT, error) {
+	opts.Dedup = true
+	opts.CountOnly = true
+	opts.OutputFormat = ""
+	opts.SplitDir = ""
+	if err := opts.validate(); err != nil {
+		return overlapT{}, fmt.Errorf("error reporting overlap: %s", err.Error())
+	}
+	acc, err := opts.accumulateSources(ctx, sources)
+	if err != nil {
+		return overlapT{}, err
+	}
+	overlap := overlapT{CoveredBlocks: acc.coveredBlocks, UniqueBlocks: acc.numActiveBlocks}
+	if acc.coveredBlocks > 0 {
+		overlap.OverlapRatio = float64(acc.coveredBlocks-acc.numActiveBlocks) / float64(acc.coveredBlocks)
+	}
+	return overlap, nil
+}
+
+// accumulateSources adds the spans decoded from sources to an accumulator,
+// with their weights if opts.Weighted is set.
+func (opts Options) accumulateSources(ctx context.Context, sources []Source) (*accumulator, error) {
+	if opts.Weighted {
+		return accumulateWeighted(ctx, opts, func(fn func(WeightedSpan) error, skip func()) error {
+			return opts.decodeSources(sources, func(r io.Reader) error {
+				return weightedSpanDecoders[opts.inputFormat()](r, fn, opts.skipBad(skip))
+			})
+		})
+	}
+	return accumulate(ctx, opts, func(fn func(Span) error, skip func()) error {
+		return opts.decodeSources(sources, func(r io.Reader) error {
+			return spanDecoders[opts.inputFormat()](r, fn, opts.skipBad(skip))
+		})
+	})
+}
+
+// contextWriter is a writer that fails once ctx is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// Flush flushes the underlying writer if it buffers its output.
+func (cw contextWriter) Flush() error {
+	if flusher, ok := cw.w.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// ReadSpans decodes the spans in r in opts.InputFormat, checking each as
+// spans to partition would be, for use as opts.Exclude.
+func ReadSpans(ctx context.Context, r io.Reader, opts Options) ([]Span, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	opts.Exclude = nil
+	produce := opts.checkSpans(ctx, func(fn func(Span) error, skip func()) error {
+		return spanDecoders[opts.inputFormat()](r, fn, opts.skipBad(skip))
+	})
+	var spans []Span
+	err = produce(func(span Span) error {
+		spans = append(spans, span)
+		return nil
+	})
+	return spans, err
+}
+
+// decodeSources calls decode with the decompressed reader of each of sources in
+// turn, or of the spans embedded in each at opts.JSONPointer, naming the
+// source in any error.
+func (opts Options) decodeSources(sources []Source, decode func(r io.Reader) error) error {
+	for _, src := range sources {
+		r, err := decompress(src.Reader)
+		if err == nil {
+			r, err = opts.embeddedSpans(r)
+		}
+		if err != nil {
+			return src.wrap(err)
+		}
+		if err := decode(r); err != nil {
+			return src.wrap(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const testSpansJSON = `[[0,0,0,40],[0,0,100,130],[0,20,0,5],[40,40,40,40]]`
+
+// run runs Run on input using opts, failing the test on error.
+func run(t *testing.T, input string, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Run(context.Background(), strings.NewReader(input), &buf, opts); err != nil {
+		t.Fatalf("error running on %s: %s", input, err.Error())
+	}
+	return buf.String()
+}
+
+func TestRun(t *testing.T) {
+	got := run(t, testSpansJSON, testOptions())
+
+	var want bytes.Buffer
+	subvolumes := partition(t, []Span{{0, 0, 0, 40}, {0, 0, 100, 130}, {0, 20, 0, 5}, {40, 40, 40, 40}}, testOptions())
+	if err := encodeJSON(&want, subvolumes); err != nil {
+		t.Fatal(err)
+	}
+	if got != want.String() {
+		t.Errorf("Run wrote\n%s\nwant the encoded Partition\n%s", got, want.String())
+	}
+
+	// The CLI writes the same output.
+	stdout, stderr, status := runCLI(t, testSpansJSON)
+	if status != 0 {
+		t.Fatalf("CLI exited with status %d: %s", status, stderr)
+	}
+	if stdout != got {
+		t.Errorf("CLI wrote\n%s\nwant\n%s", stdout, got)
+	}
+}
+
+func TestRunBadInput(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Run(context.Background(), strings.NewReader(`[[0,0,0`), &buf, testOptions()); err == nil {
+		t.Errorf("truncated input: got no error")
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	// Modes other than grid deduplicate blocks, reporting DuplicateBlocks.
+	const want = `{"NumTotalBlocks":0,"NumActiveBlocks":0,"NumActiveVoxels":0,"NumSubvolumes":0,"SubvolsPruned":0,` +
+		`"Params":{"BatchSize":[16,16,16],"BlockSize":[32,32,32],"Origin":[0,0,0],"Mode":"%s"},%s"Subvolumes":[]}` + "\n"
+	setJSON(t, false, 4)
+	for _, input := range []string{"[]", "null", " [ ]\n"} {
+		for _, mode := range []string{gridMode, "octree", "rcb"} {
+			for _, summary := range []bool{false, true} {
+				opts := testOptions()
+				opts.Mode = mode
+				opts.LeafMax = 64
+				opts.Partitions = 4
+				opts.Summary = summary
+				duplicates := `"DuplicateBlocks":0,`
+				if mode == gridMode {
+					duplicates = ""
+				}
+				if got, want := run(t, input, opts), fmt.Sprintf(want, mode, duplicates); got != want {
+					t.Errorf("input %q, %s mode, summary %t: got %s, want %s", input, mode, summary, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestGolden checks that output is byte for byte the same as the golden files
+// in testdata, whatever the order of the spans or the number of workers.  Run
+// go test -update to rewrite the golden files after an intended change.
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		golden, input string
+		edit          func(*Options)
+	}{
+		{"golden.json", "golden_spans.json", func(*Options) {}},
+		{"golden_merge.json", "golden_spans.json", func(opts *Options) { opts.MergeMax = 4096 }},
+		{"golden_octree.json", "golden_spans.json", func(opts *Options) { opts.Mode = "octree"; opts.LeafMax = 16 }},
+		{"golden_rcb.json", "golden_spans.json", func(opts *Options) { opts.Mode = "rcb"; opts.Partitions = 5 }},
+		{"golden_labeled.json", "golden_labeled_spans.json", func(opts *Options) { opts.Labeled = true }},
+	}
+	for _, test := range tests {
+		input, err := os.ReadFile(filepath.Join("testdata", test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var spans []json.RawMessage
+		if err := json.Unmarshal(input, &spans); err != nil {
+			t.Fatal(err)
+		}
+		slices.Reverse(spans)
+		reversed, err := json.Marshal(spans)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := testOptions()
+		test.edit(&opts)
+		got := run(t, string(input), opts)
+		path := filepath.Join("testdata", test.golden)
+		if *update {
+			if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.golden, got, want)
+		}
+		for _, parallel := range []int{1, 4} {
+			opts.Parallel = parallel
+			if got := run(t, string(reversed), opts); got != string(want) {
+				t.Errorf("%s: got\n%s\nfor reversed spans with %d workers, want\n%s", test.golden, got, parallel, want)
+			}
+		}
+	}
+}
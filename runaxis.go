@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Axes that input runs extend along, and the order of their coordinates:
+// [z, y, x0, x1] along x (the default), [z, x, y0, y1] along y, and
+// [x, y, z0, z1] along z.
+const (
+	xRuns = "x"
+	yRuns = "y"
+	zRuns = "z"
+)
+
+func (opts Options) runAxis() string {
+	if opts.RunAxis == "" {
+		return xRuns
+	}
+	return opts.RunAxis
+}
+
+func validateRunAxis(opts Options) error {
+	switch opts.runAxis() {
+	case xRuns:
+		return nil
+	case yRuns, zRuns:
+	default:
+		return fmt.Errorf("unknown run axis %q", opts.RunAxis)
+	}
+	if opts.Labeled || opts.Weighted || opts.inputFormat() == "points" {
+		return fmt.Errorf("runs along %s are not supported for labeled, weighted or points input", opts.RunAxis)
+	}
+	return nil
+}
+
+// runBlockSize returns the block size along the axes of the first two
+// coordinates of a run and along the run itself.
+func (opts Options) runBlockSize() [3]int64 {
+	block := opts.BlockSize
+	switch opts.runAxis() {
+	case yRuns:
+		return [3]int64{block[2], block[0], block[1]}
+	case zRuns:
+		return [3]int64{block[0], block[1], block[2]}
+	}
+	return [3]int64{block[2], block[1], block[0]}
+}
+
+// runEnds names the start and end of a run in messages, e.g. "X0" and "X1".
+func (opts Options) runEnds() (string, string) {
+	axis := strings.ToUpper(opts.runAxis())
+	return axis + "0", axis + "1"
+}
+
+// runFields names the coordinates of an input run in messages, e.g. "Z", "Y",
+// "X0" and "X1".
+func (opts Options) runFields() [4]string {
+	start, end := opts.runEnds()
+	switch opts.runAxis() {
+	case yRuns:
+		return [4]string{"Z", "X", start, end}
+	case zRuns:
+		return [4]string{"X", "Y", start, end}
+	}
+	return [4]string{"Z", "Y", start, end}
+}
+
+// runSpans passes each block of a run along y or z to fn as a span along x.
+func (opts Options) runSpans(run Span, fn func(Span) error) error {
+	for c := run[2]; c <= run[3]; c++ {
+		span := Span{run[0], c, run[1], run[1]}
+		if opts.runAxis() == zRuns {
+			span = Span{c, run[1], run[0], run[0]}
+		}
+		if err := fn(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
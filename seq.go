@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// PartitionSeq is Partition yielding each subvolume in output order instead of
+// returning them together with the summary counts, stopping after the first
+// error.  All spans are added before the first subvolume is yielded.  In grid
+// mode with scan order and no merging, adjacency or components, subvolumes are
+// generated one at a time from the occupied grid cells, so no slice of every
+// subvolume is ever built.
+func PartitionSeq(ctx context.Context, spans []Span, opts Options) iter.Seq2[subvolumeT, error] {
+	return func(yield func(subvolumeT, error) bool) {
+		if err := opts.validate(); err != nil {
+			yield(subvolumeT{}, err)
+			return
+		}
+		if opts.AssertCover {
+			yield(subvolumeT{}, fmt.Errorf("asserting cover is not supported by PartitionSeq"))
+			return
+		}
+		acc, err := accumulate(ctx, opts, sliceSpans(spans))
+		if err != nil {
+			yield(subvolumeT{}, err)
+			return
+		}
+		for subvol := range acc.subvolumeSeq() {
+			if err := ctx.Err(); err != nil {
+				yield(subvolumeT{}, err)
+				return
+			}
+			if !yield(subvol, nil) {
+				return
+			}
+		}
+	}
+}
+
+// seqCells returns true if subvolumeSeq generates each subvolume from its grid
+// cell as it is yielded, rather than listing them all first.
+func (opts Options) seqCells() bool {
+	return opts.mode() == gridMode && opts.order() == "scan" && opts.MergeMax == 0 && opts.MaxActiveBlocks == 0 && opts.ChunkAlign == 0 &&
+		!opts.SubvolumeSpans && !opts.Adjacency && !opts.Components
+}
+
+// subvolumeSeq yields the subvolumes of all blocks added so far, as listed by
+// subvolumes even if opts.Summary is set.
+func (acc *accumulator) subvolumeSeq() iter.Seq[subvolumeT] {
+	opts := acc.opts
+	if !opts.seqCells() {
+		return func(yield func(subvolumeT) bool) {
+			acc.opts.Summary = false
+			for _, subvol := range acc.subvolumes().Subvolumes {
+				if !yield(subvol) {
+					return
+				}
+			}
+		}
+	}
+	return func(yield func(subvolumeT) bool) {
+		cells := acc.emittedCells()
+		sortCells(cells)
+		bounds, _ := acc.gridBounds()
+		voxelBounds := voxelExtents(bounds, opts.BlockSize)
+		for i, cell := range cells {
+			subvol := acc.cellSubvolume(cell)
+			subvol.ID = i
+			subvol.Key = chunkKey(subvol.MinChunk)
+			if opts.Halo > 0 {
+				subvol.addHalo(opts.Halo, voxelBounds, opts.BlockSize)
+			}
+			subvol.units = opts.units()
+			subvol.halfOpen = opts.HalfOpen
+			if !yield(subvol) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// sortSpans sorts spans by z, then y, then x0.
+func sortSpans(spans []Span) {
+	sort.Slice(spans, func(i, j int) bool {
+		a, b := spans[i], spans[j]
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+}
+
+// coalesceSpans sorts spans and merges overlapping or adjacent runs within
+// each (z, y) row, dropping empty spans.  The input slice is reused.
+func coalesceSpans(spans []Span) []Span {
+	sortSpans(spans)
+	merged := spans[:0]
+	for _, span := range spans {
+		if span[2] > span[3] {
+			continue
+		}
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last[0] == span[0] && last[1] == span[1] && span[2] <= last[3]+1 {
+				if span[3] > last[3] {
+					last[3] = span[3]
+				}
+				continue
+			}
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// encodeSpans writes spans as a JSON array with one span per line.
+func encodeSpans(w io.Writer, spans []Span) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i, span := range spans {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		fmt.Fprintf(bw, "\n    [%d,%d,%d,%d]", span[0], span[1], span[2], span[3])
+	}
+	if len(spans) > 0 {
+		bw.WriteString("\n")
+	}
+	bw.WriteString("]\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import "sort"
+
+// splitSubvolumes replaces each subvolume with more than maxActive active
+// blocks by the pieces of recursively halving it along its longest axis until
+// each piece has at most maxActive of them.  spans must be the coalesced spans
+// of all active blocks, sorted by sortSpans.  Empty pieces are dropped, and
+// halos must not have been added.
+func splitSubvolumes(subvols []subvolumeT, spans []Span, maxActive int64, block Point3d) []subvolumeT {
+	split := make([]subvolumeT, 0, len(subvols))
+	for _, subvol := range subvols {
+		if subvol.ActiveBlocks <= maxActive {
+			split = append(split, subvol)
+			continue
+		}
+		box := subvol.ChunkExtents3d
+		split = splitBox(split, boxSpans(spans, box), box, maxActive, block)
+	}
+	return split
+}
+
+// boxSpans returns the parts of spans within box.  spans must be sorted by
+// sortSpans, so only those in the z range of box are clipped.
+func boxSpans(spans []Span, box ChunkExtents3d) []Span {
+	lo := sort.Search(len(spans), func(i int) bool { return spans[i][0] >= box.MinChunk[2] })
+	hi := sort.Search(len(spans), func(i int) bool { return spans[i][0] > box.MaxChunk[2] })
+	return clipSpans(spans[lo:hi], box)
+}
+
+// splitBox appends the non-empty pieces of box to subvols, halving box along
+// its longest axis while it has more than maxActive active blocks.
+func splitBox(subvols []subvolumeT, spans []Span, box ChunkExtents3d, maxActive int64, block Point3d) []subvolumeT {
+	var active int64
+	for _, span := range spans {
+		active += span[3] - span[2] + 1
+	}
+	if active == 0 {
+		return subvols
+	}
+	if active <= maxActive || box.numBlocks() == 1 {
+		return append(subvols, newSubvolume(box, active, block))
+	}
+
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if box.MaxChunk[i]-box.MinChunk[i] > box.MaxChunk[axis]-box.MinChunk[axis] {
+			axis = i
+		}
+	}
+	lo, hi := box, box
+	mid := box.MinChunk[axis] + (box.MaxChunk[axis]-box.MinChunk[axis]+1)/2
+	lo.MaxChunk[axis] = mid - 1
+	hi.MinChunk[axis] = mid
+	subvols = splitBox(subvols, clipSpans(spans, lo), lo, maxActive, block)
+	return splitBox(subvols, clipSpans(spans, hi), hi, maxActive, block)
+}
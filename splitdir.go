@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// splitIndexFile lists the subvolume files written to Options.SplitDir.  It
+// is written last, so its presence marks a complete split.
+const splitIndexFile = "index.json"
+
+// splitIndexT is the JSON content of the split index file.
+type splitIndexT struct {
+	NumSubvolumes int
+	Files         []string
+}
+
+// splitFileName returns the file name of the subvolume with the given ID.
+func splitFileName(id int) string {
+	return fmt.Sprintf("subvolume_%d.json", id)
+}
+
+// writeSplitDir writes each subvolume as JSON to its own file in dir, named by
+// its ID, then the index listing them.  dir is created if needed and must not
+// already hold a split, so files of different partitions are never mixed.
+func writeSplitDir(ctx context.Context, dir string, subvolumes subvolumesT) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating split directory: %s", err.Error())
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "subvolume_*.json"))
+	if err != nil {
+		return fmt.Errorf("error reading split directory: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(dir, splitIndexFile)); err == nil || len(existing) > 0 {
+		return fmt.Errorf("split directory %q already holds subvolume files", dir)
+	}
+
+	index := splitIndexT{NumSubvolumes: len(subvolumes.Subvolumes), Files: []string{}}
+	for _, subvol := range subvolumes.Subvolumes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := splitFileName(subvol.ID)
+		if err := writeJSONFile(filepath.Join(dir, name), subvol); err != nil {
+			return err
+		}
+		index.Files = append(index.Files, name)
+	}
+	return writeJSONFile(filepath.Join(dir, splitIndexFile), index)
+}
+
+// writeJSONFile writes v as JSON to a new file at path.
+func writeJSONFile(path string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating split file: %s", err.Error())
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing split file: %s", err.Error())
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing split file: %s", err.Error())
+	}
+	return nil
+}
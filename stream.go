@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// streamSubvolumes returns the summary counts of the subvolumes of all blocks
+// added so far, with no Subvolumes listed, and the subvolumes themselves.  In
+// grid mode with scan order and no merging or splitting the counts come from
+// the occupied grid cells alone, and the subvolumes are generated one at a
+// time as they are yielded.
+func (acc *accumulator) streamSubvolumes() (subvolumesT, iter.Seq[subvolumeT]) {
+	if !acc.opts.seqCells() {
+		subvolumes := acc.subvolumes()
+		subvols := subvolumes.Subvolumes
+		subvolumes.Subvolumes = []subvolumeT{}
+		return subvolumes, slices.Values(subvols)
+	}
+	opts := acc.opts
+	acc.opts.Summary = true
+	summary := acc.subvolumes()
+	acc.opts = opts
+	return summary, acc.subvolumeSeq()
+}
+
+// writeStream writes the subvolumes as a JSON object like encodeJSON's, but
+// with the Subvolumes array first, each subvolume written and flushed as it is
+// produced, followed by the other fields of summary.  Subvolumes must be the
+// last field of summary written as JSON.  Writing stops if ctx is done.
+func writeStream(ctx context.Context, w io.Writer, summary subvolumesT, subvols iter.Seq[subvolumeT]) error {
+	summary.Subvolumes = []subvolumeT{}
+	jsonBytes, err := json.Marshal(summary)
+	if PrettyJSON {
+		jsonBytes, err = json.MarshalIndent(summary, "", strings.Repeat(" ", JSONIndent))
+	}
+	if err != nil {
+		return fmt.Errorf("error turning partitioning into JSON: %s", err.Error())
+	}
+
+	// The fields before Subvolumes, without the braces or separators around
+	// them, and the separators of the indented or compact form.
+	indent, newline, colon := "", "", ":"
+	if PrettyJSON {
+		indent, newline, colon = strings.Repeat(" ", JSONIndent), "\n", ": "
+	}
+	key := []byte(`"Subvolumes"` + colon + `[]`)
+	end := bytes.LastIndex(jsonBytes, key)
+	if end < 0 {
+		return fmt.Errorf("error turning partitioning into JSON: no Subvolumes field")
+	}
+	fields := bytes.TrimRight(jsonBytes[1:end], " \n,")
+	fields = bytes.TrimLeft(fields, "\n")
+
+	flush := func() error {
+		if flusher, ok := w.(interface{ Flush() error }); ok {
+			return flusher.Flush()
+		}
+		return nil
+	}
+	write := func(s string, data []byte) error {
+		if _, err := io.WriteString(w, s); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+		return nil
+	}
+
+	if err := write("{"+newline+indent+`"Subvolumes"`+colon+"[", nil); err != nil {
+		return err
+	}
+	prefix := indent + indent
+	sep := newline + prefix
+	n := 0
+	for subvol := range subvols {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item, err := json.Marshal(subvol)
+		if PrettyJSON {
+			item, err = json.MarshalIndent(subvol, prefix, indent)
+		}
+		if err != nil {
+			return fmt.Errorf("error turning subvolume into JSON: %s", err.Error())
+		}
+		if err := write(sep, item); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+		sep = "," + newline + prefix
+		n++
+	}
+	closing := "]"
+	if n > 0 {
+		closing = newline + indent + "]"
+	}
+	if len(fields) > 0 {
+		closing += "," + newline
+	}
+	if err := write(closing, fields); err != nil {
+		return err
+	}
+	return write(newline+"}\n", nil)
+}
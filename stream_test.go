@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// flushCounter is a buffer counting its flushes.
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *flushCounter) Flush() error {
+	w.flushes++
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"default", func(*Options) {}},
+		{"morton", func(opts *Options) { opts.Order = "morton" }},
+		{"merged", func(opts *Options) { opts.MergeMax = 100 }},
+		{"octree", func(opts *Options) { opts.Mode = "octree"; opts.LeafMax = 8 }},
+		{"halo", func(opts *Options) { opts.Halo = 32 }},
+		{"half-open voxels", func(opts *Options) { opts.HalfOpen = true; opts.Units = voxelUnits }},
+	}
+	for _, pretty := range []bool{true, false} {
+		for _, input := range []string{testSpansJSON, "[]"} {
+			for _, test := range tests {
+				setJSON(t, pretty, 2)
+				opts := testOptions()
+				test.edit(&opts)
+				want := run(t, input, opts)
+
+				opts.Stream = true
+				var w flushCounter
+				if err := Run(t.Context(), strings.NewReader(input), &w, opts); err != nil {
+					t.Fatalf("%s: %s", test.name, err.Error())
+				}
+				got := w.String()
+
+				// The Subvolumes come first, each flushed as it is written, and
+				// the output has the same fields as the default output.
+				prefix := `{"Subvolumes":[`
+				if pretty {
+					prefix = "{\n  \"Subvolumes\": ["
+				}
+				if !strings.HasPrefix(got, prefix) {
+					t.Errorf("%s, pretty %t, input %s: got output starting %q, want %q", test.name, pretty, input, got, prefix)
+				}
+				var gotValue, wantValue interface{}
+				if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+					t.Fatalf("%s, pretty %t, input %s: error parsing %s: %s", test.name, pretty, input, got, err.Error())
+				}
+				if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(gotValue, wantValue) {
+					t.Errorf("%s, pretty %t, input %s: streamed\n%s\nwant the fields of\n%s", test.name, pretty, input, got, want)
+				}
+				if n := len(gotValue.(map[string]interface{})["Subvolumes"].([]interface{})); w.flushes != n {
+					t.Errorf("%s, pretty %t, input %s: got %d flushes for %d subvolumes", test.name, pretty, input, w.flushes, n)
+				}
+				if pretty && !strings.Contains(got, "\n    {\n      \"ID\": 0,") && input != "[]" {
+					t.Errorf("%s: subvolumes are not indented by 2 spaces per level: %s", test.name, got)
+				}
+			}
+		}
+	}
+
+	unsupported := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"summary", func(opts *Options) { opts.Summary = true }},
+		// Asserting cover needs every subvolume at once, as for PartitionSeq.
+		{"assert cover", func(opts *Options) { opts.AssertCover = true }},
+	}
+	for _, test := range unsupported {
+		opts := testOptions()
+		opts.Stream = true
+		test.edit(&opts)
+		if err := Run(t.Context(), strings.NewReader(testSpansJSON), &bytes.Buffer{}, opts); err == nil {
+			t.Errorf("streaming with %s: got no error", test.name)
+		}
+	}
+}
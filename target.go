@@ -0,0 +1,70 @@
+package main
+
+// targetSizeWindow is the number of batch sizes on each side of the bisection
+// result that targetBatchSize also tries.
+const targetSizeWindow = 8
+
+// targetBatchSize returns a cubic batch size, in blocks, whose grid starting
+// at origin has about target non-empty subvolumes covering spans.  Subvolumes
+// mostly get fewer as the size grows, but not always: blocks 2 and 3 are one
+// subvolume of size 2 but two of size 3.  So the size is found by bisection as
+// if the number were decreasing, and the sizes within targetSizeWindow of the
+// result are tried as well, which finds the closest size unless the number
+// strays further.  Ties go to the size nearest the bisection result.
+func targetBatchSize(spans []Span, origin Point3d, target int) int64 {
+	if len(spans) == 0 {
+		return 1
+	}
+	extents := spanExtents(spans)
+	lo, hi := int64(1), int64(1)
+	for i := range extents.MinChunk {
+		if size := extents.MaxChunk[i] - extents.MinChunk[i] + 1; size > hi {
+			hi = size
+		}
+	}
+
+	// Find the smallest size with at most target subvolumes.
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if countCells(spans, origin, mid) <= target {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	// Try the sizes nearest the result first, so they win ties.
+	best, bestDiff := lo, -1
+	for d := int64(0); d <= targetSizeWindow; d++ {
+		for _, size := range []int64{lo - d, lo + d} {
+			if size < 1 {
+				continue
+			}
+			diff := countCells(spans, origin, size) - target
+			if diff < 0 {
+				diff = -diff
+			}
+			if bestDiff < 0 || diff < bestDiff {
+				best, bestDiff = size, diff
+			}
+		}
+	}
+	return best
+}
+
+// countCells returns the number of non-empty subvolumes covering spans in a
+// grid of cubic subvolumes of size blocks starting at origin.
+func countCells(spans []Span, origin Point3d, size int64) int {
+	cells := make(map[Point3d]struct{})
+	for _, span := range spans {
+		if span[2] > span[3] {
+			continue
+		}
+		gy := floorDiv(span[1]-origin[1], size)
+		gz := floorDiv(span[0]-origin[2], size)
+		for gx := floorDiv(span[2]-origin[0], size); gx <= floorDiv(span[3]-origin[0], size); gx++ {
+			cells[Point3d{gx, gy, gz}] = struct{}{}
+		}
+	}
+	return len(cells)
+}
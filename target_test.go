@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestTargetBatchSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		spans  []Span
+		target int
+		size   int64
+	}{
+		{"no spans", nil, 4, 1},
+		{"exact", []Span{{0, 0, 0, 63}}, 4, 16},
+		{"one subvolume", []Span{{0, 0, 0, 63}}, 1, 64},
+		// Blocks 2-3 and 7-9 are 5 subvolumes of size 1, 3 of size 2 and 4 of
+		// size 3, so bisection alone finds size 2.
+		{"not monotonic", []Span{{0, 0, 2, 3}, {0, 0, 7, 9}}, 4, 3},
+		// Blocks 2 and 3 are one subvolume of size 2 and two of size 3.
+		{"two blocks", []Span{{0, 0, 2, 3}}, 1, 2},
+	}
+	for _, test := range tests {
+		if got := targetBatchSize(test.spans, Point3d{}, test.target); got != test.size {
+			t.Errorf("%s: got size %d, want %d", test.name, got, test.size)
+		}
+	}
+
+	// Partitioning uses the size.
+	opts := testOptions()
+	opts.TargetSubvolumes = 4
+	subvolumes := partition(t, []Span{{0, 0, 2, 3}, {0, 0, 7, 9}}, opts)
+	if subvolumes.NumSubvolumes != 4 || subvolumes.Params.BatchSize != (Point3d{3, 3, 3}) {
+		t.Errorf("got %d subvolumes of %v blocks, want 4 of 3 blocks", subvolumes.NumSubvolumes, subvolumes.Params.BatchSize)
+	}
+}
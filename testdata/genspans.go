@@ -0,0 +1,65 @@
+//go:build ignore
+
+// Genspans writes synthetic block spans for reproducing partition timings:
+//
+//	go run testdata/genspans.go -size 512 -density 0.3 > spans.json
+//	time partition < spans.json > /dev/null
+//
+// Each block of a size^3 volume is active with the given probability, and the
+// active blocks of every row are coalesced into spans.  The same seed always
+// gives the same spans, which genSpans also generates for the benchmarks of
+// go test -bench.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+var (
+	// Number of blocks along each axis of the volume.
+	size = flag.Int("size", 256, "")
+
+	// Fraction of blocks that are active.
+	density = flag.Float64("density", 0.5, "")
+
+	// Seed of the random number generator.
+	seed = flag.Int64("seed", 1, "")
+)
+
+func main() {
+	flag.Parse()
+	if *size <= 0 || *density < 0 || *density > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -size must be positive and -density between 0 and 1\n")
+		os.Exit(1)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(w, "[")
+	sep := "\n"
+	for z := 0; z < *size; z++ {
+		for y := 0; y < *size; y++ {
+			x0 := -1
+			for x := 0; x <= *size; x++ {
+				active := x < *size && rng.Float64() < *density
+				switch {
+				case active && x0 < 0:
+					x0 = x
+				case !active && x0 >= 0:
+					fmt.Fprintf(w, "%s[%d,%d,%d,%d]", sep, z, y, x0, x-1)
+					sep = ",\n"
+					x0 = -1
+				}
+			}
+		}
+	}
+	fmt.Fprint(w, "\n]\n")
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxScale is the coarsest scale of dvidtiles output, beyond which a tile
+// would cover more than every int64 block coordinate.
+const maxScale = 62
+
+// dvidTilesT is the dvidtiles output: the tiles at Scale covering each
+// subvolume.  A tile at scale N is a block of the Nth 2x downsampling, as
+// DVID addresses its multiscale levels, so it covers 2^N blocks of scale 0
+// along each axis and has the same size in downsampled voxels.
+type dvidTilesT struct {
+	Scale      int
+	BlockSize  *Point3d `json:",omitempty"`
+	Subvolumes []subvolumeTilesT
+}
+
+// subvolumeTilesT is the inclusive range of tile indices along each (x, y, z)
+// axis covering a subvolume, including any halo.
+type subvolumeTilesT struct {
+	ID       int
+	Key      string
+	MinTile  Point3d
+	MaxTile  Point3d
+	NumTiles int64
+}
+
+func validateScale(opts Options) error {
+	if opts.Scale < 0 || opts.Scale > maxScale {
+		return fmt.Errorf("scale must be between 0 and %d, got %d", maxScale, opts.Scale)
+	}
+	if opts.Scale > 0 && opts.outputFormat() != "dvidtiles" {
+		return fmt.Errorf("a scale is only supported for dvidtiles output")
+	}
+	return nil
+}
+
+// encodeDVIDTiles writes the tiles at the scale of subvolumes covering each
+// subvolume as JSON.
+func encodeDVIDTiles(w io.Writer, subvolumes subvolumesT) error {
+	tiles := dvidTilesT{
+		Scale:      subvolumes.scale,
+		BlockSize:  subvolumes.Params.BlockSize,
+		Subvolumes: make([]subvolumeTilesT, len(subvolumes.Subvolumes)),
+	}
+	size := int64(1) << uint(subvolumes.scale)
+	for i, subvol := range subvolumes.Subvolumes {
+		sub := subvolumeTilesT{ID: subvol.ID, Key: subvol.Key, NumTiles: 1}
+		for axis := range sub.MinTile {
+			sub.MinTile[axis] = floorDiv(subvol.MinChunk[axis], size)
+			sub.MaxTile[axis] = floorDiv(subvol.MaxChunk[axis], size)
+			sub.NumTiles *= sub.MaxTile[axis] - sub.MinTile[axis] + 1
+		}
+		tiles.Subvolumes[i] = sub
+	}
+	return writeJSON(w, tiles)
+}
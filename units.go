@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Units of the extents reported for each subvolume: voxel Extents3d, block
+// ChunkExtents3d, or both (the default).
+const (
+	bothUnits  = "both"
+	blockUnits = "blocks"
+	voxelUnits = "voxels"
+)
+
+// units returns opts.Units, which is always blockUnits if opts.NoVoxels is set.
+func (opts Options) units() string {
+	if opts.NoVoxels {
+		return blockUnits
+	}
+	if opts.Units == "" {
+		return bothUnits
+	}
+	return opts.Units
+}
+
+func validateUnits(units string) error {
+	switch units {
+	case bothUnits, blockUnits, voxelUnits:
+		return nil
+	}
+	return fmt.Errorf("unknown units %q", units)
+}
+
+// MarshalJSON omits the extents not in the units of the subvolume.
+func (subvol subvolumeT) MarshalJSON() ([]byte, error) {
+	subvol = subvol.reported()
+	// plain has the fields of subvolumeT without this method.  Outer fields
+	// shadow the embedded extents of the same name, and are always omitted.
+	type plain subvolumeT
+	switch subvol.units {
+	case blockUnits:
+		return json.Marshal(struct {
+			plain
+			MinPoint, MaxPoint *Point3d `json:",omitempty"`
+		}{plain: plain(subvol)})
+	case voxelUnits:
+		return json.Marshal(struct {
+			plain
+			MinChunk, MaxChunk *Point3d `json:",omitempty"`
+		}{plain: plain(subvol)})
+	}
+	return json.Marshal(plain(subvol))
+}
+
+// reported returns subvol with the maxima of its extents one past its last
+// voxel and block if they are reported as half-open.
+func (subvol subvolumeT) reported() subvolumeT {
+	if subvol.halfOpen {
+		for i := range subvol.MaxPoint {
+			subvol.MaxPoint[i]++
+			subvol.MaxChunk[i]++
+		}
+	}
+	return subvol
+}
+
+// setHalfOpen reports the maxima of the extents of the active blocks one past
+// their last voxel and block.  Those of each subvolume are set separately.
+func (subvolumes *subvolumesT) setHalfOpen() {
+	if subvolumes.ActiveExtents != nil {
+		extents := *subvolumes.ActiveExtents
+		for i := range extents.MaxPoint {
+			extents.MaxPoint[i]++
+		}
+		subvolumes.ActiveExtents = &extents
+	}
+	if subvolumes.ActiveChunkExtents != nil {
+		extents := *subvolumes.ActiveChunkExtents
+		for i := range extents.MaxChunk {
+			extents.MaxChunk[i]++
+		}
+		subvolumes.ActiveChunkExtents = &extents
+	}
+}
+
+// setUnits limits the extents reported by subvolumes to units.  The units of
+// each subvolume are set separately.
+func (subvolumes *subvolumesT) setUnits(units string) {
+	subvolumes.units = units
+	switch units {
+	case blockUnits:
+		subvolumes.ActiveExtents = nil
+	case voxelUnits:
+		subvolumes.ActiveChunkExtents = nil
+	}
+}
+
+// csvExtents returns the header columns and the values of subvol for the
+// extents in units, voxels before blocks.
+func csvExtents(subvol subvolumeT, units string) ([]string, []Point3d) {
+	subvol = subvol.reported()
+	switch units {
+	case blockUnits:
+		return csvChunkColumns, []Point3d{subvol.MinChunk, subvol.MaxChunk}
+	case voxelUnits:
+		return csvPointColumns, []Point3d{subvol.MinPoint, subvol.MaxPoint}
+	}
+	return append(csvPointColumns[:len(csvPointColumns):len(csvPointColumns)], csvChunkColumns...),
+		[]Point3d{subvol.MinPoint, subvol.MaxPoint, subvol.MinChunk, subvol.MaxChunk}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// boxVolume returns the volume of the half-open box [min, max).
+func boxVolume(min, max Point3d) int64 {
+	return (max[0] - min[0]) * (max[1] - min[1]) * (max[2] - min[2])
+}
+
+// boxesOverlap returns true if the half-open boxes [min1, max1) and
+// [min2, max2) share a point.
+func boxesOverlap(min1, max1, min2, max2 Point3d) bool {
+	for i := range min1 {
+		if max1[i] <= min2[i] || max2[i] <= min1[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHalfOpenTiling(t *testing.T) {
+	// Spans filling 40 x 20 x 20 blocks, so every grid cell of its bounding
+	// box is occupied.
+	var spans []Span
+	for z := int64(0); z < 20; z++ {
+		for y := int64(0); y < 20; y++ {
+			spans = append(spans, Span{z, y, 0, 39})
+		}
+	}
+	tests := []struct {
+		name string
+		edit func(*Options)
+	}{
+		{"default", func(*Options) {}},
+		{"origin", func(opts *Options) { opts.Origin = Point3d{5, -3, 7} }},
+		{"anisotropic", func(opts *Options) { opts.BatchSize = Point3d{16, 8, 4}; opts.BlockSize = Point3d{32, 16, 40} }},
+		{"merged", func(opts *Options) { opts.MergeMax = 8192 }},
+		{"chunk aligned", func(opts *Options) { opts.ChunkAlign = 256 }},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.edit(&opts)
+		inclusive := partition(t, spans, opts)
+		opts.HalfOpen = true
+		var output struct{ Subvolumes []subvolumeT }
+		if err := json.Unmarshal([]byte(encode(t, partition(t, spans, opts))), &output); err != nil {
+			t.Fatal(err)
+		}
+		subvols := output.Subvolumes
+		if len(subvols) != len(inclusive.Subvolumes) || len(subvols) < 2 {
+			t.Fatalf("%s: got %d half-open subvolumes and %d inclusive ones", test.name, len(subvols), len(inclusive.Subvolumes))
+		}
+
+		// Each maximum is one past the inclusive one.
+		for i, subvol := range subvols {
+			want := inclusive.Subvolumes[i]
+			for axis := range want.MaxPoint {
+				want.MaxPoint[axis]++
+				want.MaxChunk[axis]++
+			}
+			if subvol.Extents3d != want.Extents3d || subvol.ChunkExtents3d != want.ChunkExtents3d {
+				t.Errorf("%s: subvolume %d has extents %v %v, want %v %v", test.name, i,
+					subvol.Extents3d, subvol.ChunkExtents3d, want.Extents3d, want.ChunkExtents3d)
+			}
+		}
+
+		// The boxes are disjoint and their volumes add up to that of their
+		// bounding box, so they tile it without gaps.
+		minPoint, maxPoint := subvols[0].MinPoint, subvols[0].MaxPoint
+		minChunk, maxChunk := subvols[0].MinChunk, subvols[0].MaxChunk
+		var voxels, blocks int64
+		for i, a := range subvols {
+			voxels += boxVolume(a.MinPoint, a.MaxPoint)
+			blocks += boxVolume(a.MinChunk, a.MaxChunk)
+			for axis := range minPoint {
+				minPoint[axis] = min(minPoint[axis], a.MinPoint[axis])
+				maxPoint[axis] = max(maxPoint[axis], a.MaxPoint[axis])
+				minChunk[axis] = min(minChunk[axis], a.MinChunk[axis])
+				maxChunk[axis] = max(maxChunk[axis], a.MaxChunk[axis])
+			}
+			for j, b := range subvols[i+1:] {
+				if boxesOverlap(a.MinPoint, a.MaxPoint, b.MinPoint, b.MaxPoint) {
+					t.Errorf("%s: voxel extents of subvolumes %d and %d overlap", test.name, i, i+1+j)
+				}
+				if boxesOverlap(a.MinChunk, a.MaxChunk, b.MinChunk, b.MaxChunk) {
+					t.Errorf("%s: block extents of subvolumes %d and %d overlap", test.name, i, i+1+j)
+				}
+			}
+		}
+		if want := boxVolume(minPoint, maxPoint); voxels != want {
+			t.Errorf("%s: subvolumes have %d voxels, want the %d of their bounding box", test.name, voxels, want)
+		}
+		if want := boxVolume(minChunk, maxChunk); blocks != want {
+			t.Errorf("%s: subvolumes have %d blocks, want the %d of their bounding box", test.name, blocks, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// validateCommand holds the flags of the validate command, which checks the
+// input spans without partitioning them.  Its flags follow the command.
+type validateCommand struct {
+	allowNegative bool
+	maxErrors     int
+}
+
+// defineFlags defines the validate flags in flags.
+func (cmd *validateCommand) defineFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&cmd.allowNegative, "allow-negative", false, "Allow negative span coordinates")
+	flags.IntVar(&cmd.maxErrors, "max-errors", 10, "Number of errors to report")
+}
+
+// parseFlags parses the validate flags at the start of args, exiting if any
+// are invalid, and returns the remaining input files.
+func (cmd *validateCommand) parseFlags(args []string) []string {
+	flags := commandFlags("validate")
+	cmd.defineFlags(flags)
+	flags.Parse(args)
+	return flags.Args()
+}
+
+// spanValidation counts the valid and invalid spans of the input and keeps the
+// first errors.
+type spanValidation struct {
+	valid, invalid int64
+	errors         []string
+}
+
+func (v *spanValidation) fail(maxErrors int, err error) {
+	v.invalid++
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, err.Error())
+	}
+}
+
+// run checks every span decoded from sources in opts.InputFormat as Run
+// would, writes a report to w, and returns an error if any span is invalid.
+// Spans are checked by opts.checkSpans, so opts.RunAxis, opts.ExclusiveX and
+// the other options interpreting spans apply, and reversed spans are invalid
+// unless opts.Reversed swaps them.  Unless cmd.allowNegative is set, spans must
+// also have no negative input coordinates.
+func (cmd *validateCommand) run(ctx context.Context, sources []Source, w io.Writer, opts Options) error {
+	if opts.Reversed == SkipReversed {
+		opts.Reversed = RejectReversed
+	}
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("error validating spans: %s", err.Error())
+	}
+	var v spanValidation
+	// Position of the span in the input, counting malformed spans as
+	// checkSpans does.
+	var index int64
+	produce := func(fn func(Span) error, skip func()) error {
+		return opts.decodeSources(sources, func(r io.Reader) error {
+			return spanDecoders[opts.inputFormat()](r, func(span Span) error {
+				defer func() { index++ }()
+				if err := fn(span); err != nil {
+					if ctx.Err() != nil {
+						return err
+					}
+					v.fail(cmd.maxErrors, err)
+					return nil
+				}
+				if !cmd.allowNegative {
+					for i, field := range opts.runFields() {
+						if span[i] < 0 {
+							v.fail(cmd.maxErrors, fmt.Errorf("span %d %v has negative %s", index, span, field))
+							return nil
+						}
+					}
+				}
+				v.valid++
+				return nil
+			}, func(err error) error {
+				index++
+				skip()
+				v.fail(cmd.maxErrors, err)
+				return nil
+			})
+		})
+	}
+	err := opts.checkSpans(ctx, produce)(func(Span) error { return nil })
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		// The input cannot be decoded any further.
+		v.fail(cmd.maxErrors, err)
+	}
+
+	if _, err := fmt.Fprintf(w, "%d valid spans, %d invalid\n", v.valid, v.invalid); err != nil {
+		return fmt.Errorf("error writing output: %s", err.Error())
+	}
+	for _, msg := range v.errors {
+		if _, err := fmt.Fprintf(w, "  %s\n", msg); err != nil {
+			return fmt.Errorf("error writing output: %s", err.Error())
+		}
+	}
+	if v.invalid > 0 {
+		return fmt.Errorf("%d invalid spans", v.invalid)
+	}
+	return nil
+}
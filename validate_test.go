@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const input = `[[0,0,0,1],[0,0,5,3],[0,-1,2,3],[1,1,4,4],[0,0,0]]`
+	tests := []struct {
+		name          string
+		edit          func(*Options)
+		allowNegative bool
+		report        []string
+	}{
+		{"default", func(*Options) {}, false, []string{
+			"2 valid spans, 3 invalid",
+			"span 1 [0 0 5 3] has X0 > X1",
+			"span 2 [0 -1 2 3] has negative Y",
+			"span 4: [0,0,0] is not a span: expected 4 integers, got 3 elements",
+		}},
+		{"allow negative", func(*Options) {}, true, []string{
+			"3 valid spans, 2 invalid",
+			"span 1 [0 0 5 3] has X0 > X1",
+			"span 4: [0,0,0] is not a span: expected 4 integers, got 3 elements",
+		}},
+		{"swap reversed", func(opts *Options) { opts.Reversed = SwapReversed }, false, []string{
+			"3 valid spans, 2 invalid",
+			"span 2 [0 -1 2 3] has negative Y",
+			"span 4: [0,0,0] is not a span: expected 4 integers, got 3 elements",
+		}},
+		{"runs along y", func(opts *Options) { opts.RunAxis = yRuns }, false, []string{
+			"2 valid spans, 3 invalid",
+			"span 1 [0 0 5 3] has Y0 > Y1",
+			"span 2 [0 -1 2 3] has negative X",
+			"span 4: [0,0,0] is not a span: expected 4 integers, got 3 elements",
+		}},
+		// An empty exclusive span is skipped, as partitioning skips it.
+		{"exclusive x", func(opts *Options) { opts.ExclusiveX = true }, true, []string{
+			"3 valid spans, 2 invalid",
+			"span 1 [0 0 5 3] has X0 > X1",
+			"span 4: [0,0,0] is not a span: expected 4 integers, got 3 elements",
+		}},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.edit(&opts)
+		cmd := validateCommand{allowNegative: test.allowNegative, maxErrors: 10}
+		var buf bytes.Buffer
+		err := cmd.run(context.Background(), []Source{{Reader: strings.NewReader(input)}}, &buf, opts)
+		if err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+		var report []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			report = append(report, strings.TrimSpace(line))
+		}
+		if !reflect.DeepEqual(report, test.report) {
+			t.Errorf("%s: got report\n%s\nwant\n%s", test.name, strings.Join(report, "\n"), strings.Join(test.report, "\n"))
+		}
+	}
+
+	// Malformed spans are numbered with the others.
+	cmd := validateCommand{maxErrors: 10}
+	var buf bytes.Buffer
+	cmd.run(context.Background(), []Source{{Reader: strings.NewReader(`[[1,2,3],[0,0,5,1],[0,-1,0,0]]`)}}, &buf, testOptions())
+	for _, want := range []string{"span 0: [1,2,3] is not a span", "span 1 [0 0 5 1] has X0 > X1", "span 2 [0 -1 0 0] has negative Y"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got report %q, want %q", buf.String(), want)
+		}
+	}
+
+	// Spans accepted by partitioning are valid.
+	opts := testOptions()
+	opts.Reversed = SwapReversed
+	buf.Reset()
+	if err := cmd.run(context.Background(), []Source{{Reader: strings.NewReader(`[[0,0,5,3],[1,1,4,4]]`)}}, &buf, opts); err != nil {
+		t.Errorf("got error %s, report %q", err.Error(), buf.String())
+	}
+}
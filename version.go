@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Build metadata, set when building with for example
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// writeVersion writes the build metadata to w.
+func writeVersion(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "partition %s (commit %s, built %s)\n", version, commit, buildDate)
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// WeightedSpan is a span of blocks that each cost Weight to process.  It is
+// encoded in JSON as [z, y, x0, x1, weight].
+type WeightedSpan struct {
+	Span
+	Weight float64
+}
+
+// weightedSpanDecoders maps each input format supporting weighted spans to
+// its decoder.
+var weightedSpanDecoders = map[string]func(io.Reader, func(WeightedSpan) error, func(error) error) error{
+	"json":   decodeJSONArray[WeightedSpan],
+	"ndjson": decodeNDJSON[WeightedSpan],
+}
+
+// UnmarshalJSON requires span to be an array of four integers and a finite
+// number.
+func (span *WeightedSpan) UnmarshalJSON(data []byte) error {
+	values, err := tupleElements(data, len(span.Span)+1)
+	if err != nil {
+		return err
+	}
+	if err := parseInts(data, values[:len(span.Span)], span.Span[:], 0); err != nil {
+		return err
+	}
+	weight, err := strconv.ParseFloat(string(values[len(span.Span)]), 64)
+	if err != nil || math.IsInf(weight, 0) {
+		return newSpanError(data, fmt.Sprintf("element %d is not a weight", len(span.Span)))
+	}
+	span.Weight = weight
+	return nil
+}
+
+// PartitionWeighted is Partition for spans with per-block weights, also
+// reporting the TotalWeight of each subvolume.
+func PartitionWeighted(ctx context.Context, spans []WeightedSpan, opts Options) (subvolumesT, error) {
+	opts.Weighted = true
+	if err := opts.validate(); err != nil {
+		return subvolumesT{}, err
+	}
+	acc, err := accumulateWeighted(ctx, opts, func(fn func(WeightedSpan) error, skip func()) error {
+		for _, span := range spans {
+			if err := fn(span); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return subvolumesT{}, err
+	}
+	return acc.subvolumes(), nil
+}
+
+// accumulateWeighted adds every span passed to fn by produce to an
+// accumulator, along with its weight.  produce calls skip for each malformed
+// span it skips.
+func accumulateWeighted(ctx context.Context, opts Options, produce func(fn func(WeightedSpan) error, skip func()) error) (*accumulator, error) {
+	opts.Origin = opts.alignedOrigin()
+	acc := newAccumulator(opts)
+	var index int64
+	progress := progress{ctx: ctx, opts: opts}
+	exclude := newExclusion(opts.Exclude)
+	err := produce(func(weighted WeightedSpan) error {
+		span, ok, err := opts.checkSpan(index, weighted.Span)
+		index++
+		if !ok {
+			return err
+		}
+		if err := progress.add(span); err != nil {
+			return err
+		}
+		return exclude.subtract(span, func(span Span) error {
+			return acc.countWeighted(span, weighted.Weight)
+		})
+	}, func() { index++ })
+	progress.done()
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}